@@ -0,0 +1,41 @@
+package zredis
+
+import (
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// CredentialsProvider 返回连接使用的用户名和密码，每次建立新连接时调用，
+// 用于从密钥管理服务获取会轮换的短期凭证，不需要重建连接池
+type CredentialsProvider func() (username, password string, err error)
+
+// Authenticate 在连接上完成认证，password 为空时不认证
+// username 不为空时使用 Redis 6 ACL 的 AUTH username password
+// hello 为 true 时使用 HELLO 2 AUTH 认证，服务端不支持 HELLO（Redis 6 以下）时回退到 AUTH
+func Authenticate(c redis.Conn, username, password string, hello bool) error {
+	if password == "" {
+		return nil
+	}
+	if hello {
+		user := username
+		if user == "" {
+			user = "default"
+		}
+		_, err := c.Do("HELLO", 2, "AUTH", user, password)
+		if err == nil || !isUnknownCommand(err) {
+			return err
+		}
+	}
+	if username != "" {
+		_, err := c.Do("AUTH", username, password)
+		return err
+	}
+	_, err := c.Do("AUTH", password)
+	return err
+}
+
+func isUnknownCommand(err error) bool {
+	_, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(strings.ToLower(err.Error()), "err unknown command")
+}
@@ -0,0 +1,112 @@
+package zredis
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// newAuthServer 记录收到的认证命令，hello 为 false 时模拟不支持 HELLO 的旧版本
+func newAuthServer(t *testing.T, hello bool) (*fakeServer, func() []string) {
+	var mu sync.Mutex
+	var cmds []string
+	s := newFakeServer(t, func(args []string) interface{} {
+		switch args[0] {
+		case "AUTH", "HELLO":
+			mu.Lock()
+			cmds = append(cmds, strings.Join(args, " "))
+			mu.Unlock()
+			if args[0] == "HELLO" && !hello {
+				return redis.Error("ERR unknown command 'HELLO'")
+			}
+			if args[len(args)-1] == "wrong" {
+				return redis.Error("WRONGPASS invalid username-password pair")
+			}
+			if args[0] == "HELLO" {
+				return []interface{}{[]byte("server"), []byte("redis"), []byte("proto"), 2}
+			}
+		}
+		return "OK"
+	})
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), cmds...)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name               string
+		hello              bool
+		serverHello        bool
+		username, password string
+		want               []string
+	}{
+		{"no password", false, true, "user", "", nil},
+		{"password", false, true, "", "secret", []string{"AUTH secret"}},
+		{"acl", false, true, "user", "secret", []string{"AUTH user secret"}},
+		{"hello", true, true, "user", "secret", []string{"HELLO 2 AUTH user secret"}},
+		{"hello default user", true, true, "", "secret", []string{"HELLO 2 AUTH default secret"}},
+		{"hello fallback", true, false, "user", "secret", []string{"HELLO 2 AUTH user secret", "AUTH user secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cmds := newAuthServer(t, tt.serverHello)
+			c, err := redis.Dial("tcp", s.Addr())
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer c.Close()
+			if err := Authenticate(c, tt.username, tt.password, tt.hello); err != nil {
+				t.Fatalf("Authenticate err: %v", err)
+			}
+			if got := cmds(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	s, cmds := newAuthServer(t, true)
+	c, _ := redis.Dial("tcp", s.Addr())
+	defer c.Close()
+	if err := Authenticate(c, "user", "wrong", true); err == nil {
+		t.Error("Expected auth error")
+	}
+	if got := cmds(); len(got) != 1 {
+		t.Errorf("Expected no fallback after auth error, got %v", got)
+	}
+}
+
+func TestCredentialsProvider(t *testing.T) {
+	s, cmds := newAuthServer(t, true)
+	var mu sync.Mutex
+	tokens := []string{"token1", "token2"}
+	r := newRedisPool(WithUsername("ignored"), WithCredentialsProvider(func() (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(tokens) == 0 {
+			return "", "", errors.New("secret manager unavailable")
+		}
+		token := tokens[0]
+		tokens = tokens[1:]
+		return "app", token, nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		c, err := r.config.Dial(s.Addr(), "static", 0)
+		if err != nil {
+			t.Fatalf("dial err: %v", err)
+		}
+		c.Close()
+	}
+	if got := cmds(); strings.Join(got, ",") != "AUTH app token1,AUTH app token2" {
+		t.Errorf("Expected provider called on every dial, got %v", got)
+	}
+	if _, err := r.config.Dial(s.Addr(), "static", 0); err == nil || !strings.Contains(err.Error(), "secret manager") {
+		t.Errorf("Expected provider error, got %v", err)
+	}
+}
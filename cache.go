@@ -0,0 +1,377 @@
+package zredis
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// ErrNotFound 回源函数返回 nil 数据，或命中了缓存的空值
+	ErrNotFound = errors.New("zredis: data not found")
+	// ErrLoader 回源函数返回错误，可以用 errors.Is 同时判断原始错误
+	ErrLoader = errors.New("zredis: cache loader failed")
+)
+
+// DefaultNegativeValue 默认的空值标记，开启空值缓存时写入该值
+var DefaultNegativeValue = []byte("\x00zrc\x02")
+
+// cacheEntryMagic 带元数据的缓存值前缀，后跟逻辑过期时间和重建耗时（毫秒）
+var cacheEntryMagic = []byte("\x00zrc\x01")
+
+// cacheErrorMagic 缓存的回源错误前缀，后跟错误信息
+var cacheErrorMagic = []byte("\x00zrc\x03")
+
+type cacheOptions struct {
+	ttl        time.Duration
+	namespace  string
+	lockTTL    time.Duration
+	lockWait   time.Duration
+	lockRetry  time.Duration
+	lockSuffix string
+	stale      time.Duration
+	beta       float64
+
+	negativeTTL   time.Duration
+	negativeValue []byte
+	errorTTL      time.Duration
+}
+
+// Cache_func 缓存回调的配置选项
+type Cache_func func(*cacheOptions)
+
+// WithCacheTTL 设置缓存时间，默认 86400 秒，仅对 FuncType 生效
+func WithCacheTTL(ttl time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithCacheNamespace 设置进程内回源合并的命名空间，不同 Redis 实例上的同名 key 互不合并
+func WithCacheNamespace(namespace string) Cache_func {
+	return func(o *cacheOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithCacheLock 开启分布式重建锁（SET NX PX），多个进程同一时间只有一个执行回源
+// lockTTL 为锁的过期时间，wait 为未抢到锁且没有旧值时等待新值的最长时间，超时后直接回源
+func WithCacheLock(lockTTL, wait time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.lockTTL = lockTTL
+		o.lockWait = wait
+	}
+}
+
+// WithCacheLockRetry 设置等待新值时的轮询间隔，默认 50ms
+func WithCacheLockRetry(interval time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.lockRetry = interval
+	}
+}
+
+// WithCacheStale 缓存逻辑过期后继续保留 stale 时间，重建期间其他调用方直接返回旧值
+// 开启后缓存值会带上元数据，需要通过缓存回调函数读取
+func WithCacheStale(stale time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.stale = stale
+	}
+}
+
+// WithCacheXFetch 开启概率提前过期（XFetch），越接近过期、回源越慢越可能提前重建，beta 一般取 1
+// 开启后缓存值会带上元数据，需要通过缓存回调函数读取
+func WithCacheXFetch(beta float64) Cache_func {
+	return func(o *cacheOptions) {
+		o.beta = beta
+	}
+}
+
+// WithCacheNegative 回源返回 nil 时缓存空值标记 ttl 时间，期间直接返回 ErrNotFound，不再回源
+func WithCacheNegative(ttl time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithCacheNegativeValue 设置空值标记，默认 DefaultNegativeValue，不能与正常数据相同
+func WithCacheNegativeValue(value []byte) Cache_func {
+	return func(o *cacheOptions) {
+		o.negativeValue = value
+	}
+}
+
+// WithCacheError 回源返回错误时缓存错误信息 ttl 时间，期间直接返回 ErrLoader，避免故障时持续回源
+func WithCacheError(ttl time.Duration) Cache_func {
+	return func(o *cacheOptions) {
+		o.errorTTL = ttl
+	}
+}
+
+func newCacheOptions(opts ...Cache_func) *cacheOptions {
+	o := &cacheOptions{
+		ttl:           86400 * time.Second,
+		lockRetry:     50 * time.Millisecond,
+		lockSuffix:    ":lock",
+		negativeValue: DefaultNegativeValue,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// withEntry 是否需要在缓存值中保存元数据
+func (o *cacheOptions) withEntry() bool {
+	return o.stale > 0 || o.beta > 0
+}
+
+// CallBackCacheWithCommander 带缓存的回调函数，同一进程内相同 key 的回源会合并为一次
+// 可以通过 Cache_func 开启分布式重建锁、旧值兜底、概率提前过期以及空值和错误缓存
+// funcs 返回 nil 数据时返回 ErrNotFound，返回错误时返回包装了原始错误的 ErrLoader，有旧值时返回旧值
+func CallBackCacheWithCommander(commander RedisCommander, redisKey string, funcs FuncType, opts ...Cache_func) ([]byte, error) {
+	o := newCacheOptions(opts...)
+	return getCache(commander, redisKey, o, func() ([]byte, time.Time, error) {
+		res, err := funcs()
+		return res, time.Now().Add(o.ttl), err
+	})
+}
+
+// CallBackCacheInWithCommander 带内部时间控制的缓存回调函数，funcs 返回的时间戳为过期时间，小于等于0不过期
+func CallBackCacheInWithCommander(commander RedisCommander, redisKey string, funcs FuncTypeInt, opts ...Cache_func) ([]byte, error) {
+	o := newCacheOptions(opts...)
+	return getCache(commander, redisKey, o, func() ([]byte, time.Time, error) {
+		res, timeOut, err := funcs()
+		if timeOut > 0 {
+			return res, time.Unix(timeOut, 0), err
+		}
+		return res, time.Time{}, err
+	})
+}
+
+// cacheLoader 回源函数，返回数据和逻辑过期时间，零值表示不过期
+type cacheLoader func() ([]byte, time.Time, error)
+
+func getCache(commander RedisCommander, key string, o *cacheOptions, load cacheLoader) ([]byte, error) {
+	raw, err := redis.Bytes(commander.Get(key))
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+	var stale []byte
+	if err == nil {
+		entry := decodeCacheEntry(raw)
+		if entry.fresh(time.Now(), o.beta) {
+			return o.result(entry.data)
+		}
+		stale = entry.data
+	}
+	return cacheFlight.do(o.namespace+"\x00"+key, stale, func() ([]byte, error) {
+		return rebuildCache(commander, key, o, stale, load)
+	})
+}
+
+// rebuildCache 回源并写入缓存，开启重建锁时只有抢到锁的调用方回源
+func rebuildCache(commander RedisCommander, key string, o *cacheOptions, stale []byte, load cacheLoader) ([]byte, error) {
+	if o.lockTTL > 0 {
+		lockKey := key + o.lockSuffix
+		token := randomToken()
+		reply, err := commander.Cmd("SET", lockKey, token, "NX", "PX", durationMs(o.lockTTL))
+		if err == nil && reply == nil {
+			if stale != nil {
+				return stale, nil
+			}
+			if data, ok := waitCache(commander, key, o); ok {
+				return o.result(data)
+			}
+		}
+		if err == nil && reply != nil {
+			defer commander.LuaScript(lockReleaseScript, lockKey, token)
+		}
+	}
+
+	start := time.Now()
+	data, expireAt, err := load()
+	if err != nil {
+		if stale != nil {
+			return stale, nil
+		}
+		if o.errorTTL > 0 {
+			value := append(append([]byte{}, cacheErrorMagic...), err.Error()...)
+			commander.Cmd("SET", key, value, "PX", durationMs(o.errorTTL))
+		}
+		return nil, fmt.Errorf("%w: %w", ErrLoader, err)
+	}
+	if data == nil {
+		if o.negativeTTL > 0 {
+			commander.Cmd("SET", key, o.negativeValue, "PX", durationMs(o.negativeTTL))
+		}
+		return nil, ErrNotFound
+	}
+	if err := writeCache(commander, key, o, data, expireAt, time.Since(start)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// waitCache 等待其他进程重建完成，超时返回 false
+func waitCache(commander RedisCommander, key string, o *cacheOptions) ([]byte, bool) {
+	ctx := commanderContext(commander)
+	deadline := time.Now().Add(o.lockWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(o.lockRetry):
+		}
+		raw, err := redis.Bytes(commander.Get(key))
+		if err == nil {
+			return decodeCacheEntry(raw).data, true
+		}
+		if err != redis.ErrNil {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// result 把缓存的空值标记和错误信息转换为对应的错误
+func (o *cacheOptions) result(data []byte) ([]byte, error) {
+	if len(o.negativeValue) > 0 && bytes.Equal(data, o.negativeValue) {
+		return nil, ErrNotFound
+	}
+	if bytes.HasPrefix(data, cacheErrorMagic) {
+		return nil, fmt.Errorf("%w: %s", ErrLoader, data[len(cacheErrorMagic):])
+	}
+	return data, nil
+}
+
+func writeCache(commander RedisCommander, key string, o *cacheOptions, data []byte, expireAt time.Time, delta time.Duration) error {
+	value := data
+	if o.withEntry() {
+		value = encodeCacheEntry(data, expireAt, delta)
+	}
+	args := []interface{}{key, value}
+	if !expireAt.IsZero() {
+		ttl := time.Until(expireAt) + o.stale
+		if ttl <= 0 {
+			// 已经过期的数据不写入缓存
+			return nil
+		}
+		args = append(args, "PX", durationMs(ttl))
+	}
+	_, err := commander.Cmd("SET", args...)
+	return err
+}
+
+type cacheEntry struct {
+	data     []byte
+	expireAt time.Time
+	delta    time.Duration
+}
+
+// fresh 判断缓存是否可以直接使用，beta 大于0时按 XFetch 算法概率提前过期
+func (e cacheEntry) fresh(now time.Time, beta float64) bool {
+	if e.expireAt.IsZero() {
+		return true
+	}
+	if !now.Before(e.expireAt) {
+		return false
+	}
+	if beta > 0 && e.delta > 0 {
+		early := time.Duration(float64(e.delta) * beta * -math.Log(1-mrand.Float64()))
+		return now.Add(early).Before(e.expireAt)
+	}
+	return true
+}
+
+func encodeCacheEntry(data []byte, expireAt time.Time, delta time.Duration) []byte {
+	buf := make([]byte, len(cacheEntryMagic)+16+len(data))
+	n := copy(buf, cacheEntryMagic)
+	if !expireAt.IsZero() {
+		binary.BigEndian.PutUint64(buf[n:], uint64(expireAt.UnixMilli()))
+	}
+	binary.BigEndian.PutUint64(buf[n+8:], uint64(delta.Milliseconds()))
+	copy(buf[n+16:], data)
+	return buf
+}
+
+// decodeCacheEntry 解析缓存值，不带元数据的值视为永不过期
+func decodeCacheEntry(raw []byte) cacheEntry {
+	n := len(cacheEntryMagic)
+	if len(raw) < n+16 || !bytes.Equal(raw[:n], cacheEntryMagic) {
+		return cacheEntry{data: raw}
+	}
+	entry := cacheEntry{
+		data:  raw[n+16:],
+		delta: time.Duration(binary.BigEndian.Uint64(raw[n+8:])) * time.Millisecond,
+	}
+	if ms := int64(binary.BigEndian.Uint64(raw[n:])); ms > 0 {
+		entry.expireAt = time.UnixMilli(ms)
+	}
+	return entry
+}
+
+// cacheGroup 进程内的回源合并
+type cacheGroup struct {
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+type cacheCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+var cacheFlight = &cacheGroup{calls: make(map[string]*cacheCall)}
+
+// do 相同 key 同一时间只执行一次 fn，有旧值时等待者直接返回旧值
+func (g *cacheGroup) do(key string, stale []byte, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		if stale != nil {
+			return stale, nil
+		}
+		call.wg.Wait()
+		return call.data, call.err
+	}
+	call := &cacheCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.data, call.err = fn()
+	return call.data, call.err
+}
+
+// randomToken 生成随机令牌，用于锁的持有者校验
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+	}
+	return hex.EncodeToString(b)
+}
+
+// durationMs 转换为毫秒，不足 1ms 按 1ms
+func durationMs(d time.Duration) int64 {
+	if ms := d.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
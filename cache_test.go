@@ -0,0 +1,288 @@
+package zredis
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memStore 内存实现的 GET/SET(NX/PX)/DEL 和锁脚本，用于缓存回调和分布式锁测试
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemCommander() (*memStore, RedisCommander) {
+	m := &memStore{data: make(map[string][]byte)}
+	return m, NewRedisCommands(m.execute, m.luaExecute)
+}
+
+func (m *memStore) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	return v, ok
+}
+
+func (m *memStore) set(key string, val []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = val
+}
+
+func (m *memStore) execute(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := keysAndArgs[0].(string)
+	switch cmdStr {
+	case "GET":
+		if v, ok := m.data[key]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "SET":
+		for _, arg := range keysAndArgs[2:] {
+			if s, ok := arg.(string); ok && strings.EqualFold(s, "NX") {
+				if _, exists := m.data[key]; exists {
+					return nil, nil
+				}
+			}
+		}
+		switch v := keysAndArgs[1].(type) {
+		case []byte:
+			m.data[key] = v
+		case string:
+			m.data[key] = []byte(v)
+		}
+		return "OK", nil
+	case "DEL":
+		delete(m.data, key)
+		return int64(1), nil
+	}
+	return "OK", nil
+}
+
+func (m *memStore) luaExecute(script string, key string, args ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if string(m.data[key]) != args[0].(string) {
+		return int64(0), nil
+	}
+	if script == lockReleaseScript {
+		delete(m.data, key)
+	}
+	return int64(1), nil
+}
+
+func TestCallBackCache_Singleflight(t *testing.T) {
+	_, commander := newMemCommander()
+	var calls int32
+	loader := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("value"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := CallBackCacheWithCommander(commander, "cache:sf", loader)
+			if err != nil || string(res) != "value" {
+				t.Errorf("Expected value, got %s %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Expected loader to run once, ran %d times", calls)
+	}
+
+	res, err := CallBackMsgpackCacheWithCommander(commander, "cache:sf", loader)
+	if err != nil || string(res) != "value" || calls != 1 {
+		t.Errorf("Expected cached value, got %s %v (calls %d)", res, err, calls)
+	}
+}
+
+func TestCallBackCache_LockWaitsForOtherProcess(t *testing.T) {
+	store, commander := newMemCommander()
+	store.set("cache:lock-wait:lock", []byte("other"))
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		store.set("cache:lock-wait", []byte("fresh"))
+	}()
+
+	res, err := CallBackCacheWithCommander(commander, "cache:lock-wait", func() ([]byte, error) {
+		t.Error("loader should not run while another process holds the lock")
+		return []byte("loaded"), nil
+	}, WithCacheLock(time.Second, time.Second), WithCacheLockRetry(5*time.Millisecond))
+	if err != nil || string(res) != "fresh" {
+		t.Errorf("Expected fresh, got %s %v", res, err)
+	}
+}
+
+func TestCallBackCache_LockReleased(t *testing.T) {
+	store, commander := newMemCommander()
+	res, err := CallBackCacheWithCommander(commander, "cache:lock", func() ([]byte, error) {
+		if _, ok := store.get("cache:lock:lock"); !ok {
+			t.Error("Expected rebuild lock to be held while loading")
+		}
+		return []byte("loaded"), nil
+	}, WithCacheLock(time.Second, time.Second))
+	if err != nil || string(res) != "loaded" {
+		t.Errorf("Expected loaded, got %s %v", res, err)
+	}
+	if _, ok := store.get("cache:lock:lock"); ok {
+		t.Error("Expected rebuild lock to be released")
+	}
+}
+
+func TestCallBackCache_ServeStale(t *testing.T) {
+	store, commander := newMemCommander()
+	store.set("cache:stale", encodeCacheEntry([]byte("old"), time.Now().Add(-time.Second), 0))
+	store.set("cache:stale:lock", []byte("other"))
+
+	res, err := CallBackCacheWithCommander(commander, "cache:stale", func() ([]byte, error) {
+		t.Error("loader should not run while another process holds the lock")
+		return nil, nil
+	}, WithCacheStale(time.Minute), WithCacheLock(time.Second, time.Second))
+	if err != nil || string(res) != "old" {
+		t.Errorf("Expected stale value, got %s %v", res, err)
+	}
+
+	store.execute("DEL", "cache:stale:lock")
+	res, err = CallBackCacheWithCommander(commander, "cache:stale", func() ([]byte, error) {
+		return []byte("new"), nil
+	}, WithCacheStale(time.Minute), WithCacheLock(time.Second, time.Second))
+	if err != nil || string(res) != "new" {
+		t.Errorf("Expected rebuilt value, got %s %v", res, err)
+	}
+	raw, _ := store.get("cache:stale")
+	if entry := decodeCacheEntry(raw); string(entry.data) != "new" || entry.expireAt.IsZero() {
+		t.Errorf("Expected entry with metadata, got %+v", entry)
+	}
+}
+
+func TestCacheEntry_XFetch(t *testing.T) {
+	now := time.Now()
+	entry := cacheEntry{data: []byte("v"), expireAt: now.Add(time.Second), delta: time.Hour}
+	if entry.fresh(now, 1) {
+		t.Error("Expected early expiration when rebuild takes longer than remaining ttl")
+	}
+	if !entry.fresh(now, 0) {
+		t.Error("Expected fresh without XFetch")
+	}
+	entry.delta = time.Nanosecond
+	if !entry.fresh(now, 1) {
+		t.Error("Expected fresh when rebuild is fast")
+	}
+	if (cacheEntry{expireAt: now.Add(-time.Second)}).fresh(now, 0) {
+		t.Error("Expected expired entry")
+	}
+}
+
+func TestCacheEntry_Encode(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Minute).UnixMilli())
+	entry := decodeCacheEntry(encodeCacheEntry([]byte("data"), expireAt, 20*time.Millisecond))
+	if !bytes.Equal(entry.data, []byte("data")) || !entry.expireAt.Equal(expireAt) || entry.delta != 20*time.Millisecond {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	plain := decodeCacheEntry([]byte("raw"))
+	if string(plain.data) != "raw" || !plain.expireAt.IsZero() {
+		t.Errorf("Expected plain value, got %+v", plain)
+	}
+}
+
+func TestCallBackCacheIn_ExpireAt(t *testing.T) {
+	store, commander := newMemCommander()
+	res, err := CallBackCacheInWithCommander(commander, "cache:in", func() ([]byte, int64, error) {
+		return []byte("v"), time.Now().Add(time.Hour).Unix(), nil
+	})
+	if err != nil || string(res) != "v" {
+		t.Errorf("Expected v, got %s %v", res, err)
+	}
+	if raw, ok := store.get("cache:in"); !ok || string(raw) != "v" {
+		t.Errorf("Expected plain cached value, got %q", raw)
+	}
+
+	_, err = CallBackCacheInWithCommander(commander, "cache:in-past", func() ([]byte, int64, error) {
+		return []byte("v"), time.Now().Add(-time.Hour).Unix(), nil
+	})
+	if _, ok := store.get("cache:in-past"); err != nil || ok {
+		t.Errorf("Expected expired data not to be cached, err %v", err)
+	}
+}
+
+func TestCallBackCache_Negative(t *testing.T) {
+	store, commander := newMemCommander()
+	var calls int32
+	loader := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	}
+	for i := 0; i < 3; i++ {
+		_, err := CallBackCacheWithCommander(commander, "cache:neg", loader, WithCacheNegative(time.Minute))
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected loader to run once, ran %d times", calls)
+	}
+	if raw, _ := store.get("cache:neg"); !bytes.Equal(raw, DefaultNegativeValue) {
+		t.Errorf("Expected negative sentinel, got %q", raw)
+	}
+
+	_, err := CallBackCacheInWithCommander(commander, "cache:neg-in", func() ([]byte, int64, error) {
+		return nil, 0, nil
+	}, WithCacheNegative(time.Minute), WithCacheNegativeValue([]byte("<nil>")))
+	if raw, _ := store.get("cache:neg-in"); !errors.Is(err, ErrNotFound) || string(raw) != "<nil>" {
+		t.Errorf("Expected custom sentinel, got %q %v", raw, err)
+	}
+
+	if _, err := CallBackMsgpackCacheWithCommander(commander, "cache:neg-legacy", loader); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, ok := store.get("cache:neg-legacy"); ok {
+		t.Error("Expected miss not to be cached without WithCacheNegative")
+	}
+}
+
+func TestCallBackCache_LoaderError(t *testing.T) {
+	store, commander := newMemCommander()
+	errDB := errors.New("db down")
+	var calls int32
+	loader := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errDB
+	}
+
+	_, err := CallBackCacheWithCommander(commander, "cache:err", loader)
+	if !errors.Is(err, ErrLoader) || !errors.Is(err, errDB) {
+		t.Errorf("Expected ErrLoader wrapping errDB, got %v", err)
+	}
+	if _, ok := store.get("cache:err"); ok {
+		t.Error("Expected loader error not to be cached by default")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = CallBackCacheWithCommander(commander, "cache:err", loader, WithCacheError(time.Minute))
+		if !errors.Is(err, ErrLoader) || !strings.Contains(err.Error(), "db down") {
+			t.Errorf("Expected cached ErrLoader, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected loader to run twice, ran %d times", calls)
+	}
+
+	store.set("cache:err-stale", encodeCacheEntry([]byte("old"), time.Now().Add(-time.Second), 0))
+	res, err := CallBackCacheWithCommander(commander, "cache:err-stale", loader, WithCacheStale(time.Minute))
+	if err != nil || string(res) != "old" {
+		t.Errorf("Expected stale value on loader error, got %s %v", res, err)
+	}
+}
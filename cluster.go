@@ -0,0 +1,524 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ClusterSlots Redis Cluster 的槽位数量
+const ClusterSlots = 16384
+
+const clusterMaxRedirects = 5
+
+// ErrClusterNoNodes 无法从任何节点加载槽位信息
+var ErrClusterNoNodes = errors.New("zredis: no reachable cluster node")
+
+// ClusterClient Redis Cluster 客户端，按槽位把命令路由到对应的主节点，每个节点一个连接池
+// 命令返回 MOVED/ASK 时自动重定向，MOVED 和连接错误会触发重新加载槽位信息
+// 所有节点的连接共用一个 ConnTracker，支持 ctx 中断、统计和优雅关闭
+type ClusterClient struct {
+	template *RedisPool
+	auth     string
+	seeds    []string
+
+	mu      sync.RWMutex
+	closed  bool
+	slots   [ClusterSlots]string
+	masters []string
+	pools   map[string]*redis.Pool
+
+	refreshMu  sync.Mutex
+	refreshing int32
+}
+
+// NewClusterClient 使用种子节点创建集群客户端，opts 作用于每个节点的连接池
+func NewClusterClient(addrs []string, auth string, opts ...Redis_func) (*ClusterClient, error) {
+	c := &ClusterClient{
+		template: newRedisPool(opts...),
+		auth:     auth,
+		seeds:    append([]string(nil), addrs...),
+		pools:    make(map[string]*redis.Pool),
+	}
+	if err := c.Refresh(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Commander 返回集群模式的命令实例，Keys、DelPattern 和 Scan 会在所有主节点上执行
+func (c *ClusterClient) Commander() RedisCommanderCtx {
+	return &clusterCommands{
+		RedisCommanderCtx: NewRedisCommandsCtx(c.DoCtx, c.LuaScriptCtx, WithCommandsCodec(c.template.codec)),
+		cluster:           c,
+	}
+}
+
+// Do 执行命令，可作为 NewRedisCommands 的 executor
+func (c *ClusterClient) Do(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	return c.DoCtx(context.Background(), cmdStr, keysAndArgs...)
+}
+
+// LuaScript 执行Lua脚本，可作为 NewRedisCommands 的 luaExecutor
+func (c *ClusterClient) LuaScript(script string, key string, args ...interface{}) (interface{}, error) {
+	return c.LuaScriptCtx(context.Background(), script, key, args...)
+}
+
+// LuaScriptCtx 执行Lua脚本，按 key 所在槽位路由
+func (c *ClusterClient) LuaScriptCtx(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+	return CachedScript(script).Run(NewRedisCommandsCtx(c.DoCtx, nil).WithContext(ctx), []string{key}, args...)
+}
+
+// DoCtx 执行命令，根据命令中的 key 计算槽位并路由到对应节点，处理 MOVED/ASK 重定向
+func (c *ClusterClient) DoCtx(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	addr := ""
+	if key, ok := clusterCommandKey(cmdStr, keysAndArgs); ok {
+		addr = c.slotAddr(Slot(key))
+	}
+	if addr == "" {
+		addr = c.anyMaster()
+	}
+	if addr == "" {
+		return nil, ErrClusterNoNodes
+	}
+
+	asking := false
+	var reply interface{}
+	var err error
+	for attempt := 0; attempt <= clusterMaxRedirects; attempt++ {
+		reply, err = c.doNode(ctx, addr, asking, cmdStr, keysAndArgs...)
+		asking = false
+		if err == nil || ctx.Err() != nil || err == ErrPoolClosed {
+			return reply, err
+		}
+
+		if e, ok := err.(redis.Error); ok {
+			kind, slot, target := parseRedirect(string(e))
+			switch kind {
+			case "MOVED":
+				c.setSlot(slot, target)
+				c.refreshAsync()
+				addr = target
+				continue
+			case "ASK":
+				addr, asking = target, true
+				continue
+			case "TRYAGAIN", "CLUSTERDOWN":
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+				}
+				continue
+			}
+			return reply, err
+		}
+
+		// 连接错误，重新加载槽位信息后重试
+		if c.refresh(ctx) != nil {
+			return reply, err
+		}
+		if key, ok := clusterCommandKey(cmdStr, keysAndArgs); ok {
+			addr = c.slotAddr(Slot(key))
+		} else {
+			addr = c.anyMaster()
+		}
+	}
+	return reply, err
+}
+
+// doNode 在指定节点上执行命令，asking 为 true 时先发送 ASKING
+func (c *ClusterClient) doNode(ctx context.Context, addr string, asking bool, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	pool, err := c.pool(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.template.config.Tracker.Get(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	if !asking {
+		return DoContext(ctx, conn, cmdStr, keysAndArgs...)
+	}
+	return RunContext(ctx, conn, func(conn redis.Conn) (interface{}, error) {
+		conn.Send("ASKING")
+		conn.Send(cmdStr, keysAndArgs...)
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Receive(); err != nil {
+			return nil, err
+		}
+		return conn.Receive()
+	})
+}
+
+// ForEachMaster 在每个主节点上执行 fn，node 的命令只发送到该节点
+func (c *ClusterClient) ForEachMaster(ctx context.Context, fn func(node RedisCommanderCtx) error) error {
+	c.mu.RLock()
+	masters := append([]string(nil), c.masters...)
+	c.mu.RUnlock()
+	for _, addr := range masters {
+		if err := fn(c.nodeCommander(ctx, addr)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeCommander 返回只发送到 addr 节点的命令实例
+func (c *ClusterClient) nodeCommander(ctx context.Context, addr string) RedisCommanderCtx {
+	return NewRedisCommandsCtx(
+		func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+			return c.doNode(ctx, addr, false, cmdStr, keysAndArgs...)
+		},
+		func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+			return c.LuaScriptCtx(ctx, script, key, args...)
+		},
+	).WithContext(ctx)
+}
+
+// Masters 返回当前所有主节点地址
+func (c *ClusterClient) Masters() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.masters...)
+}
+
+// Refresh 使用 CLUSTER SLOTS 重新加载槽位信息，关闭已经不在拓扑中的节点的连接池
+func (c *ClusterClient) Refresh() error {
+	return c.refresh(context.Background())
+}
+
+func (c *ClusterClient) refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	addrs := append(append([]string(nil), c.masters...), c.seeds...)
+	c.mu.RUnlock()
+
+	var lastErr error = ErrClusterNoNodes
+	for _, addr := range addrs {
+		reply, err := c.doNode(ctx, addr, false, "CLUSTER", "SLOTS")
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil || err == ErrPoolClosed {
+				break
+			}
+			continue
+		}
+		slots, masters, err := parseClusterSlots(reply, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.masters = masters
+		removed := c.removeStalePools()
+		c.mu.Unlock()
+		for _, pool := range removed {
+			pool.Close()
+		}
+		return nil
+	}
+	return fmt.Errorf("zredis: load cluster slots: %w", lastErr)
+}
+
+// refreshAsync 在后台重新加载槽位信息，同一时间只有一个加载任务
+func (c *ClusterClient) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.Refresh()
+	}()
+}
+
+// Close 关闭所有节点的连接池，之后执行命令返回 ErrPoolClosed，正在执行的命令会返回错误
+func (c *ClusterClient) Close() error {
+	for _, pool := range c.closePools() {
+		c.template.config.Tracker.Close(pool)
+	}
+	return nil
+}
+
+// Shutdown 优雅关闭所有节点的连接池：拒绝新的命令，等待执行中的命令结束后关闭连接，
+// ctx 结束时强制关闭剩余连接并返回 ctx.Err()
+func (c *ClusterClient) Shutdown(ctx context.Context) error {
+	var err error
+	for _, pool := range c.closePools() {
+		if e := c.template.config.Tracker.Shutdown(ctx, pool); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Stats 返回所有节点连接池的统计之和
+func (c *ClusterClient) Stats() PoolStats {
+	stats := c.template.config.Tracker.Stats(nil)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, pool := range c.pools {
+		ps := pool.Stats()
+		stats.ActiveCount += ps.ActiveCount
+		stats.IdleCount += ps.IdleCount
+	}
+	return stats
+}
+
+// closePools 标记为已关闭并移除所有节点的连接池
+func (c *ClusterClient) closePools() []*redis.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	pools := make([]*redis.Pool, 0, len(c.pools))
+	for addr, pool := range c.pools {
+		pools = append(pools, pool)
+		delete(c.pools, addr)
+	}
+	return pools
+}
+
+// removeStalePools 移除不是主节点也不是种子节点的连接池，调用时需要持有 c.mu
+func (c *ClusterClient) removeStalePools() []*redis.Pool {
+	keep := make(map[string]bool, len(c.masters)+len(c.seeds))
+	for _, addr := range c.masters {
+		keep[addr] = true
+	}
+	for _, addr := range c.seeds {
+		keep[addr] = true
+	}
+	var removed []*redis.Pool
+	for addr, pool := range c.pools {
+		if !keep[addr] {
+			removed = append(removed, pool)
+			delete(c.pools, addr)
+		}
+	}
+	return removed
+}
+
+// pool 返回 addr 节点的连接池，不存在时创建，关闭后返回 ErrPoolClosed
+func (c *ClusterClient) pool(addr string) (*redis.Pool, error) {
+	c.mu.RLock()
+	pool, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return pool, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrPoolClosed
+	}
+	if pool, ok := c.pools[addr]; ok {
+		return pool, nil
+	}
+	pool = c.template.config.NewPool(func() (redis.Conn, error) {
+		return c.template.config.Dial(addr, c.auth, 0)
+	})
+	c.pools[addr] = pool
+	return pool, nil
+}
+
+func (c *ClusterClient) slotAddr(slot int) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.slots[slot]
+}
+
+func (c *ClusterClient) setSlot(slot int, addr string) {
+	if slot < 0 || slot >= ClusterSlots {
+		return
+	}
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+}
+
+func (c *ClusterClient) anyMaster() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.masters) > 0 {
+		return c.masters[0]
+	}
+	if len(c.seeds) > 0 {
+		return c.seeds[0]
+	}
+	return ""
+}
+
+// clusterCommands 集群模式的命令实例，需要遍历所有节点的命令在每个主节点上执行
+type clusterCommands struct {
+	RedisCommanderCtx
+	cluster *ClusterClient
+}
+
+func (r *clusterCommands) WithContext(ctx context.Context) RedisCommanderCtx {
+	return &clusterCommands{
+		RedisCommanderCtx: r.RedisCommanderCtx.WithContext(ctx),
+		cluster:           r.cluster,
+	}
+}
+
+// Codec 返回集群连接池配置的编解码器
+func (r *clusterCommands) Codec() Codec {
+	return codecOf(r.RedisCommanderCtx)
+}
+
+func (r *clusterCommands) Keys(pre_key string) (interface{}, error) {
+	keys := make([]interface{}, 0)
+	err := r.cluster.ForEachMaster(r.Context(), func(node RedisCommanderCtx) error {
+		values, err := redis.Values(node.Keys(pre_key))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, values...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *clusterCommands) DelPattern(patternKey string) error {
+	return r.cluster.ForEachMaster(r.Context(), func(node RedisCommanderCtx) error {
+		return node.DelPattern(patternKey)
+	})
+}
+
+// Slot 计算 key 所在的槽位，支持 {hash tag}
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % ClusterSlots)
+}
+
+// clusterCommandKey 返回命令中用于路由的 key
+func clusterCommandKey(cmdStr string, keysAndArgs []interface{}) (string, bool) {
+	switch strings.ToUpper(cmdStr) {
+	case "PING", "SCAN", "KEYS", "SCRIPT", "INFO", "DBSIZE", "RANDOMKEY", "CLUSTER", "FLUSHDB", "FLUSHALL", "PUBLISH", "ECHO", "TIME":
+		return "", false
+	case "EVAL", "EVALSHA":
+		if len(keysAndArgs) > 2 {
+			if n, _ := strconv.Atoi(argString(keysAndArgs[1])); n > 0 {
+				return argString(keysAndArgs[2]), true
+			}
+		}
+		return "", false
+	case "XREAD", "XREADGROUP":
+		for i, arg := range keysAndArgs {
+			if strings.EqualFold(argString(arg), "STREAMS") && i+1 < len(keysAndArgs) {
+				return argString(keysAndArgs[i+1]), true
+			}
+		}
+		return "", false
+	}
+	if len(keysAndArgs) == 0 {
+		return "", false
+	}
+	return argString(keysAndArgs[0]), true
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseRedirect 解析 MOVED/ASK 等集群错误
+func parseRedirect(msg string) (kind string, slot int, addr string) {
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return "", -1, ""
+	}
+	kind = fields[0]
+	if (kind == "MOVED" || kind == "ASK") && len(fields) == 3 {
+		slot, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return "", -1, ""
+		}
+		return kind, slot, fields[2]
+	}
+	return kind, -1, ""
+}
+
+// parseClusterSlots 解析 CLUSTER SLOTS 的回复，节点 host 为空时使用 from 的 host
+func parseClusterSlots(reply interface{}, from string) ([ClusterSlots]string, []string, error) {
+	var slots [ClusterSlots]string
+	ranges, err := redis.Values(reply, nil)
+	if err != nil {
+		return slots, nil, err
+	}
+	fromHost, _, _ := net.SplitHostPort(from)
+	masters := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, r := range ranges {
+		fields, err := redis.Values(r, nil)
+		if err != nil || len(fields) < 3 {
+			return slots, nil, fmt.Errorf("zredis: unexpected cluster slots reply %v", r)
+		}
+		start, err1 := redis.Int(fields[0], nil)
+		end, err2 := redis.Int(fields[1], nil)
+		node, err3 := redis.Values(fields[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(node) < 2 || start < 0 || end >= ClusterSlots {
+			return slots, nil, fmt.Errorf("zredis: unexpected cluster slots reply %v", r)
+		}
+		host, _ := redis.String(node[0], nil)
+		port, _ := redis.Int(node[1], nil)
+		if host == "" {
+			host = fromHost
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = addr
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			masters = append(masters, addr)
+		}
+	}
+	if len(masters) == 0 {
+		return slots, nil, ErrClusterNoNodes
+	}
+	return slots, masters, nil
+}
+
+// crc16 CRC16-CCITT (XMODEM)，Redis Cluster 使用的槽位哈希算法
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
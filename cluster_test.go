@@ -0,0 +1,367 @@
+package zredis
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// fakeClusterNode 模拟集群节点，只处理自身槽位内的 key，其他 key 返回 MOVED
+type fakeClusterNode struct {
+	mu       sync.Mutex
+	server   *fakeServer
+	start    int
+	end      int
+	data     map[string]string
+	asking   bool
+	lastCmds []string
+	layout   func() interface{}
+	owner    func(slot int) *fakeClusterNode
+	askSlot  int
+	askNode  *fakeClusterNode
+	down     bool
+}
+
+func newFakeClusterNode(t *testing.T, start, end int) *fakeClusterNode {
+	n := &fakeClusterNode{start: start, end: end, data: make(map[string]string), askSlot: -1}
+	n.server = newFakeServer(t, n.handle)
+	return n
+}
+
+func (n *fakeClusterNode) handle(args []string) interface{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastCmds = append(n.lastCmds, args[0])
+	asking := n.asking
+	n.asking = false
+	switch args[0] {
+	case "CLUSTER":
+		return n.layout()
+	case "PING":
+		return "PONG"
+	case "ASKING":
+		n.asking = true
+		return "OK"
+	case "KEYS", "SCAN":
+		keys := make([]string, 0, len(n.data))
+		for key := range n.data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if args[0] == "SCAN" {
+			return []interface{}{[]byte("0"), keys}
+		}
+		return keys
+	}
+
+	if n.down {
+		return redis.Error("CLUSTERDOWN The cluster is down")
+	}
+	key := args[1]
+	slot := Slot(key)
+	if slot == n.askSlot {
+		return redis.Error("ASK " + strconv.Itoa(slot) + " " + n.askNode.server.Addr())
+	}
+	if (slot < n.start || slot > n.end) && !asking {
+		return redis.Error("MOVED " + strconv.Itoa(slot) + " " + n.owner(slot).server.Addr())
+	}
+	switch args[0] {
+	case "SET":
+		n.data[key] = args[2]
+		return "OK"
+	case "GET":
+		if v, ok := n.data[key]; ok {
+			return []byte(v)
+		}
+		return nil
+	case "DEL":
+		if _, ok := n.data[key]; ok {
+			delete(n.data, key)
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return redis.Error("ERR unknown command " + args[0])
+}
+
+func (n *fakeClusterNode) slotRange() interface{} {
+	host, port, _ := net.SplitHostPort(n.server.Addr())
+	p, _ := strconv.Atoi(port)
+	return []interface{}{int64(n.start), int64(n.end), []interface{}{[]byte(host), int64(p), []byte("id")}}
+}
+
+func (n *fakeClusterNode) keys() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.data)
+}
+
+func newFakeCluster(t *testing.T) (*fakeClusterNode, *fakeClusterNode) {
+	a := newFakeClusterNode(t, 0, 8191)
+	b := newFakeClusterNode(t, 8192, ClusterSlots-1)
+	layout := func() interface{} {
+		return []interface{}{a.slotRange(), b.slotRange()}
+	}
+	owner := func(slot int) *fakeClusterNode {
+		if slot <= a.end {
+			return a
+		}
+		return b
+	}
+	a.layout, b.layout = layout, layout
+	a.owner, b.owner = owner, owner
+	return a, b
+}
+
+func TestSlot(t *testing.T) {
+	if crc16("123456789") != 0x31C3 {
+		t.Errorf("Expected crc16 0x31C3, got %#x", crc16("123456789"))
+	}
+	if Slot("foo") != 12182 {
+		t.Errorf("Expected slot 12182, got %d", Slot("foo"))
+	}
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Errorf("Expected same slot for same hash tag")
+	}
+	if Slot("foo{}{bar}") != int(crc16("foo{}{bar}")%ClusterSlots) {
+		t.Errorf("Expected empty hash tag to hash whole key")
+	}
+	if Slot("foo{{bar}}zap") != Slot("{bar") {
+		t.Errorf("Expected hash tag '{bar'")
+	}
+	if Slot("foo{bar}{zap}") != Slot("bar") {
+		t.Errorf("Expected first hash tag 'bar'")
+	}
+}
+
+func TestClusterClient_Routing(t *testing.T) {
+	a, b := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+	if len(cluster.Masters()) != 2 {
+		t.Fatalf("Expected 2 masters, got %v", cluster.Masters())
+	}
+
+	commander := cluster.Commander()
+	for i := 0; i < 20; i++ {
+		if _, err := commander.Set("test:key"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if a.keys() == 0 || b.keys() == 0 || a.keys()+b.keys() != 20 {
+		t.Errorf("Expected keys spread across nodes, got %d and %d", a.keys(), b.keys())
+	}
+
+	v, err := redis.String(commander.Get("test:key3"))
+	if err != nil || v != "v" {
+		t.Errorf("Expected 'v', got %v %v", v, err)
+	}
+
+	keys, err := redis.Strings(commander.Keys("test:*"))
+	if err != nil || len(keys) != 20 {
+		t.Errorf("Expected 20 keys from all masters, got %d %v", len(keys), err)
+	}
+
+	if err := commander.DelPattern("test:*"); err != nil {
+		t.Errorf("DelPattern failed: %v", err)
+	}
+	if a.keys()+b.keys() != 0 {
+		t.Errorf("Expected all keys deleted, got %d and %d", a.keys(), b.keys())
+	}
+}
+
+func TestClusterClient_Moved(t *testing.T) {
+	a, b := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+
+	// 模拟本地槽位信息过期
+	slot := Slot("foo")
+	cluster.setSlot(slot, a.server.Addr())
+	if _, err := cluster.Do("SET", "foo", "bar"); err != nil {
+		t.Fatalf("Expected MOVED to be followed, got %v", err)
+	}
+	if b.keys() != 1 {
+		t.Errorf("Expected key on node b, got %d", b.keys())
+	}
+	if cluster.slotAddr(slot) != b.server.Addr() {
+		t.Errorf("Expected slot map to be updated after MOVED")
+	}
+}
+
+func TestClusterClient_Ask(t *testing.T) {
+	a, b := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+
+	// 槽位正在从 b 迁移到 a
+	slot := Slot("foo")
+	b.mu.Lock()
+	b.askSlot, b.askNode = slot, a
+	b.mu.Unlock()
+	if _, err := cluster.Do("SET", "foo", "bar"); err != nil {
+		t.Fatalf("Expected ASK to be followed, got %v", err)
+	}
+	if a.keys() != 1 {
+		t.Errorf("Expected key on node a, got %d", a.keys())
+	}
+	a.mu.Lock()
+	cmds := a.lastCmds
+	a.mu.Unlock()
+	if len(cmds) < 2 || cmds[len(cmds)-2] != "ASKING" {
+		t.Errorf("Expected ASKING before command, got %v", cmds)
+	}
+	if cluster.slotAddr(slot) != b.server.Addr() {
+		t.Errorf("Expected slot map not to change after ASK")
+	}
+}
+
+func TestClusterClient_ClusterDownContext(t *testing.T) {
+	a, b := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+	for _, n := range []*fakeClusterNode{a, b} {
+		n.mu.Lock()
+		n.down = true
+		n.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := cluster.DoCtx(ctx, "GET", "foo"); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected backoff to stop on ctx done, took %v", elapsed)
+	}
+}
+
+func TestClusterClient_RefreshClosesRemovedPools(t *testing.T) {
+	a, _ := newFakeCluster(t)
+	left := newFakeClusterNode(t, 0, -1)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+
+	pool, _ := cluster.pool(left.server.Addr())
+	if err := cluster.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	cluster.mu.RLock()
+	_, ok := cluster.pools[left.server.Addr()]
+	_, seed := cluster.pools[a.server.Addr()]
+	cluster.mu.RUnlock()
+	if ok {
+		t.Errorf("Expected pool of removed node to be dropped")
+	}
+	if !seed {
+		t.Errorf("Expected pool of seed node to be kept")
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if conn.Err() == nil {
+		t.Errorf("Expected pool of removed node to be closed")
+	}
+}
+
+func TestClusterClient_CloseAndStats(t *testing.T) {
+	a, _ := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	commander := cluster.Commander()
+	commander.Set("foo", "bar")
+	if stats := cluster.Stats(); stats.Dials < 2 || stats.InUseCount != 0 || stats.ActiveCount == 0 {
+		t.Errorf("Expected node connections tracked, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cluster.refresh(ctx); err == nil {
+		t.Error("Expected refresh to honor the caller ctx")
+	}
+
+	if err := cluster.Close(); err != nil {
+		t.Errorf("Close err: %v", err)
+	}
+	if _, err := commander.Get("foo"); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed after Close, got %v", err)
+	}
+	if _, err := cluster.pool(a.server.Addr()); err != ErrPoolClosed {
+		t.Errorf("Expected no new pool after Close, got %v", err)
+	}
+	if err := cluster.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected Shutdown after Close to succeed, got %v", err)
+	}
+}
+
+func TestClusterClient_Scan(t *testing.T) {
+	a, b := newFakeCluster(t)
+	cluster, err := NewClusterClient([]string{a.server.Addr()}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cluster.Close()
+	commander := cluster.Commander()
+	for i := 0; i < 20; i++ {
+		commander.Set("scan:"+strconv.Itoa(i), "v")
+	}
+	if a.keys() == 0 || b.keys() == 0 {
+		t.Fatalf("Expected keys on both masters, got %d and %d", a.keys(), b.keys())
+	}
+
+	var keys []string
+	it := Scan(context.Background(), commander)
+	for it.Next() {
+		keys = append(keys, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Scan err: %v", err)
+	}
+	if len(keys) != 20 {
+		t.Errorf("Expected 20 keys from all masters, got %d", len(keys))
+	}
+}
+
+func TestClusterCommandKey(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"foo"}, "foo", true},
+		{"EVALSHA", []interface{}{"sha", 2, "k1", "k2"}, "k1", true},
+		{"EVAL", []interface{}{"return 1", 0}, "", false},
+		{"XREAD", []interface{}{"COUNT", 1, "STREAMS", "s1", "0"}, "s1", true},
+		{"PING", nil, "", false},
+	}
+	for _, tt := range tests {
+		key, ok := clusterCommandKey(tt.cmd, tt.args)
+		if key != tt.key || ok != tt.ok {
+			t.Errorf("%s: expected %q %v, got %q %v", tt.cmd, tt.key, tt.ok, key, ok)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package zredis
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newObjectCommander 使用内存存储模拟 SET/SETEX/GET/HSET/HGETALL
+func newObjectCommander(codec Codec) RedisCommander {
+	strs := map[string][]byte{}
+	hashes := map[string]map[string][]byte{}
+	toBytes := func(v interface{}) []byte {
+		switch v := v.(type) {
+		case []byte:
+			return v
+		case string:
+			return []byte(v)
+		case int64:
+			return []byte(strconv.FormatInt(v, 10))
+		}
+		return nil
+	}
+	exec := func(cmd string, args ...interface{}) (interface{}, error) {
+		key := args[0].(string)
+		switch cmd {
+		case "SET":
+			strs[key] = toBytes(args[1])
+			return "OK", nil
+		case "SETEX":
+			strs[key] = toBytes(args[2])
+			return "OK", nil
+		case "GET":
+			if v, ok := strs[key]; ok {
+				return v, nil
+			}
+			return nil, nil
+		case "HSET":
+			h := hashes[key]
+			if h == nil {
+				h = map[string][]byte{}
+				hashes[key] = h
+			}
+			for i := 1; i+1 < len(args); i += 2 {
+				h[args[i].(string)] = toBytes(args[i+1])
+			}
+			return int64(len(args) / 2), nil
+		case "HGETALL":
+			values := []interface{}{}
+			for k, v := range hashes[key] {
+				values = append(values, []byte(k), v)
+			}
+			return values, nil
+		}
+		return nil, errors.New("unexpected command " + cmd)
+	}
+	lua := func(script, key string, args ...interface{}) (interface{}, error) { return nil, nil }
+	return NewRedisCommands(exec, lua, WithCommandsCodec(codec))
+}
+
+type codecUser struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, GobCodec} {
+		commander := newObjectCommander(codec)
+		in := codecUser{Name: "alice", Age: 30, Tags: []string{"a", "b"}}
+		if err := SetObject(commander, "user:1", in, 60); err != nil {
+			t.Fatalf("%s: SetObject err: %v", codec.Name(), err)
+		}
+		out, err := GetObject[codecUser](commander, "user:1")
+		if err != nil {
+			t.Fatalf("%s: GetObject err: %v", codec.Name(), err)
+		}
+		if out.Name != in.Name || out.Age != in.Age || len(out.Tags) != 2 {
+			t.Errorf("%s: expected %+v, got %+v", codec.Name(), in, out)
+		}
+		ptr, err := GetObject[*codecUser](commander, "user:1")
+		if err != nil || ptr == nil || ptr.Name != in.Name {
+			t.Errorf("%s: expected pointer result, got %+v %v", codec.Name(), ptr, err)
+		}
+	}
+}
+
+func TestCodecs_Protobuf(t *testing.T) {
+	commander := newObjectCommander(ProtobufCodec)
+	if err := SetObject(commander, "pb", wrapperspb.String("hello"), 0); err != nil {
+		t.Fatalf("SetObject err: %v", err)
+	}
+	msg, err := GetObject[*wrapperspb.StringValue](commander, "pb")
+	if err != nil || msg.GetValue() != "hello" {
+		t.Errorf("Expected hello, got %v %v", msg, err)
+	}
+	if err := SetObject(commander, "pb", codecUser{}, 0); !errors.Is(err, ErrNotProtoMessage) {
+		t.Errorf("Expected ErrNotProtoMessage, got %v", err)
+	}
+}
+
+func TestGetObject_Nil(t *testing.T) {
+	commander := newObjectCommander(JSONCodec)
+	if _, err := GetObject[codecUser](commander, "missing"); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+}
+
+func TestCodecOf_Default(t *testing.T) {
+	commander := NewRedisCommands(nil, nil)
+	if codecOf(commander) != DefaultCodec {
+		t.Errorf("Expected DefaultCodec")
+	}
+	if codecOf(newObjectCommander(MsgpackCodec)) != MsgpackCodec {
+		t.Errorf("Expected MsgpackCodec")
+	}
+}
+
+type hashProfile struct {
+	ID      int64     `redis:"id"`
+	Name    string    `redis:"name"`
+	Score   float64   `redis:"score"`
+	Active  bool      `redis:"active"`
+	Meta    codecUser `redis:"meta"`
+	Ignored string    `redis:"-"`
+	private string
+}
+
+func TestHSetStruct_RoundTrip(t *testing.T) {
+	commander := newObjectCommander(MsgpackCodec)
+	in := hashProfile{ID: 7, Name: "bob", Score: 1.5, Active: true, Meta: codecUser{Name: "m", Age: 1}, Ignored: "x", private: "y"}
+	if err := HSetStruct(commander, "profile:7", &in); err != nil {
+		t.Fatalf("HSetStruct err: %v", err)
+	}
+	out, err := HGetAllStruct[hashProfile](commander, "profile:7")
+	if err != nil {
+		t.Fatalf("HGetAllStruct err: %v", err)
+	}
+	if out.ID != 7 || out.Name != "bob" || out.Score != 1.5 || !out.Active || out.Meta.Name != "m" {
+		t.Errorf("Unexpected struct: %+v", out)
+	}
+	if out.Ignored != "" || out.private != "" {
+		t.Errorf("Ignored fields should not be stored: %+v", out)
+	}
+	if _, err := HGetAllStruct[hashProfile](commander, "profile:missing"); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+	if err := HSetStruct(commander, "profile:bad", 1); err == nil {
+		t.Errorf("Expected error for non-struct value")
+	}
+}
@@ -1,22 +1,45 @@
 package zredis
 
 import (
+	"context"
 	"sync"
 )
 
 // 全局Redis命令实例，基于统一的命令接口
 var (
-	globalCommander RedisCommander
+	globalCommander RedisCommanderCtx
 	once            sync.Once
 )
 
 // 初始化全局命令实例，使用sync.Once确保线程安全
 func initGlobalCommander() {
 	once.Do(func() {
-		globalCommander = NewRedisCommands(CommonCmd, CommonLuaScript)
+		globalCommander = NewRedisCommandsCtx(CommonCmdCtx, CommonLuaScriptCtx, withPoolCodec)
 	})
 }
 
+// withPoolCodec 全局命令实例使用当前全局连接池的编解码器
+func withPoolCodec(r *redisCommands) {
+	r.codec = func() Codec {
+		if r := redisPool.Load(); r != nil {
+			return r.codec
+		}
+		return nil
+	}
+}
+
+// GetCommander 获取全局命令实例
+func GetCommander() RedisCommanderCtx {
+	initGlobalCommander()
+	return globalCommander
+}
+
+// GetCommanderCtx 获取绑定了ctx的全局命令实例
+func GetCommanderCtx(ctx context.Context) RedisCommanderCtx {
+	initGlobalCommander()
+	return globalCommander.WithContext(ctx)
+}
+
 // -------------------------  公众函数  -----------------------
 // 使用统一命令接口的包装函数，保持向后兼容性
 func CommonGet(key string) (interface{}, error) {
@@ -151,6 +174,12 @@ func CommonBitCount(key string) (interface{}, error) {
 	return globalCommander.BitCount(key)
 }
 
+// CommonPublish 发布消息，返回收到消息的订阅者数量
+func CommonPublish(channel string, message interface{}) (int64, error) {
+	initGlobalCommander()
+	return globalCommander.Publish(channel, message)
+}
+
 func CommonDel(key string) (interface{}, error) {
 	initGlobalCommander()
 	return globalCommander.Del(key)
@@ -260,8 +289,26 @@ func CallBackMsgpackCacheIn(redisKey string, funcs FuncTypeInt) ([]byte, error)
 	return CallBackMsgpackCacheInWithCommander(globalCommander, redisKey, funcs)
 }
 
+// CallBackCache 带缓存的回调函数，同一进程内相同 key 的回源会合并为一次，支持重建锁、旧值兜底和概率提前过期
+func CallBackCache(redisKey string, funcs FuncType, opts ...Cache_func) ([]byte, error) {
+	initGlobalCommander()
+	return CallBackCacheWithCommander(globalCommander, redisKey, funcs, opts...)
+}
+
+// CallBackCacheIn 根据回源数据中的时间戳设置过期时间，选项同 CallBackCache
+func CallBackCacheIn(redisKey string, funcs FuncTypeInt, opts ...Cache_func) ([]byte, error) {
+	initGlobalCommander()
+	return CallBackCacheInWithCommander(globalCommander, redisKey, funcs, opts...)
+}
+
 // 批量删除key
 func CommonDelPattern(patternKey string) (err error) {
 	initGlobalCommander()
 	return globalCommander.DelPattern(patternKey)
 }
+
+// CommonRunScript 执行脚本，KEYS 数量不限
+func CommonRunScript(script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	initGlobalCommander()
+	return script.Run(globalCommander, keys, args...)
+}
@@ -1,11 +1,13 @@
 package zredis
 
 import (
-	"errors"
+	"context"
 	"github.com/garyburd/redigo/redis"
+	"time"
 )
 
 // RedisCommander 统一的Redis命令接口
+// Publish、Stream 等新增命令直接加在该接口上，自行实现该接口的类型可以嵌入 NewRedisCommandsCtx 返回的实例获得这些方法
 type RedisCommander interface {
 	// 核心命令方法
 	Cmd(cmdStr string, keysAndArgs ...interface{}) (interface{}, error)
@@ -21,6 +23,7 @@ type RedisCommander interface {
 	Exists(key string) (interface{}, error)
 	Expire(key string, timeInt int) error
 	ExpireAt(key string, timestampInt int64) (interface{}, error)
+	// Keys 会阻塞服务端，生产环境请使用 Scan 迭代器
 	Keys(pre_key string) (interface{}, error)
 	
 	// 计数命令  
@@ -64,140 +67,273 @@ type RedisCommander interface {
 	BRPop(key string, timeout int) (interface{}, error)
 	LLen(key string) (interface{}, error)
 	
+	// Stream命令
+	XAdd(args XAddArgs) (string, error)
+	XLen(key string) (int64, error)
+	XDel(key string, ids ...string) (int64, error)
+	XRange(key, start, end string, count int64) ([]XMessage, error)
+	XRevRange(key, end, start string, count int64) ([]XMessage, error)
+	XRead(args XReadArgs) ([]XStream, error)
+	XReadGroup(args XReadGroupArgs) ([]XStream, error)
+	XAck(key, group string, ids ...string) (int64, error)
+	XPending(key, group string) (*XPending, error)
+	XPendingExt(args XPendingExtArgs) ([]XPendingEntry, error)
+	XClaim(args XClaimArgs) ([]XMessage, error)
+	XAutoClaim(args XAutoClaimArgs) (messages []XMessage, next string, err error)
+	XGroupCreate(key, group, start string, mkStream bool) error
+	XGroupSetID(key, group, id string) error
+	XGroupDestroy(key, group string) (int64, error)
+	XGroupCreateConsumer(key, group, consumer string) (int64, error)
+	XGroupDelConsumer(key, group, consumer string) (int64, error)
+
 	// Bit命令
 	SetBit(key string, offset, val interface{}) (interface{}, error)
 	GetBit(key string, offset interface{}) (interface{}, error)
 	BitCount(key string) (interface{}, error)
 	
+	// 发布订阅
+	Publish(channel string, message interface{}) (int64, error)
+	SPublish(channel string, message interface{}) (int64, error)
+
 	// 模式删除
 	DelPattern(patternKey string) error
 }
 
+// RedisCommanderCtx 支持context的Redis命令接口
+// 通过 WithContext 绑定context后，所有命令都会遵守该context的取消与截止时间
+type RedisCommanderCtx interface {
+	RedisCommander
+
+	// WithContext 返回绑定了ctx的命令实例，原实例不受影响，ctx 为 nil 时使用 context.Background()
+	WithContext(ctx context.Context) RedisCommanderCtx
+	// Context 返回当前绑定的context，未绑定时为 context.Background()
+	Context() context.Context
+}
+
+// CmdExecutorCtx 支持context的命令执行函数
+type CmdExecutorCtx func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error)
+
+// LuaExecutorCtx 支持context的Lua脚本执行函数
+type LuaExecutorCtx func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error)
+
 // 统一的Redis命令实现
 type redisCommands struct {
-	executor func(cmdStr string, keysAndArgs ...interface{}) (interface{}, error)
-	luaExecutor func(script string, key string, args ...interface{}) (interface{}, error)
+	ctx         context.Context
+	executor    CmdExecutorCtx
+	luaExecutor LuaExecutorCtx
+	codec       func() Codec
+	// queued 命令只入队，结果由 Exec 返回
+	queued bool
+}
+
+// Commands_func 命令实例的配置选项
+type Commands_func func(*redisCommands)
+
+// WithCommandsCodec 设置 SetObject/GetObject 等对象读写使用的编解码器
+func WithCommandsCodec(codec Codec) Commands_func {
+	return func(r *redisCommands) {
+		r.codec = func() Codec { return codec }
+	}
+}
+
+// withQueuedCommands Pipeline 和 Tx 使用，标记命令只入队不返回结果
+func withQueuedCommands() Commands_func {
+	return func(r *redisCommands) {
+		r.queued = true
+	}
+}
+
+func NewRedisCommands(executor func(string, ...interface{}) (interface{}, error), luaExecutor func(string, string, ...interface{}) (interface{}, error), opts ...Commands_func) RedisCommander {
+	return NewRedisCommandsCtx(
+		func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+			return executor(cmdStr, keysAndArgs...)
+		},
+		func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+			return luaExecutor(script, key, args...)
+		},
+		opts...,
+	)
 }
 
-func NewRedisCommands(executor func(string, ...interface{}) (interface{}, error), luaExecutor func(string, string, ...interface{}) (interface{}, error)) RedisCommander {
-	return &redisCommands{
-		executor: executor,
+// NewRedisCommandsCtx 使用支持context的执行函数创建命令实例
+func NewRedisCommandsCtx(executor CmdExecutorCtx, luaExecutor LuaExecutorCtx, opts ...Commands_func) RedisCommanderCtx {
+	r := &redisCommands{
+		ctx:         context.Background(),
+		executor:    executor,
 		luaExecutor: luaExecutor,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *redisCommands) WithContext(ctx context.Context) RedisCommanderCtx {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+func (r *redisCommands) Context() context.Context {
+	return r.ctx
+}
+
+// Codec 返回对象读写使用的编解码器，未设置时为 DefaultCodec
+func (r *redisCommands) Codec() Codec {
+	if r.codec != nil {
+		if codec := r.codec(); codec != nil {
+			return codec
+		}
+	}
+	return DefaultCodec
+}
+
+// queuesCommands 返回命令是否只入队，见 commandQueuer
+func (r *redisCommands) queuesCommands() bool {
+	return r.queued
+}
+
+// commanderContext 返回命令实例绑定的context
+func commanderContext(commander RedisCommander) context.Context {
+	if c, ok := commander.(interface{ Context() context.Context }); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
+
+// commanderWithContext 支持context的命令实例绑定ctx，否则原样返回
+func commanderWithContext(commander RedisCommander, ctx context.Context) RedisCommander {
+	if c, ok := commander.(RedisCommanderCtx); ok && ctx != nil {
+		return c.WithContext(ctx)
+	}
+	return commander
+}
+
+// do 使用当前绑定的context执行命令
+func (r *redisCommands) do(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	return r.executor(r.ctx, cmdStr, keysAndArgs...)
+}
+
+// doBlock 执行最多阻塞 block 时间的命令，block <= 0 表示一直阻塞
+func (r *redisCommands) doBlock(block time.Duration, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	return r.executor(withBlockTimeout(r.ctx, block), cmdStr, keysAndArgs...)
 }
 
 func (r *redisCommands) Cmd(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
-	return r.executor(cmdStr, keysAndArgs...)
+	return r.do(cmdStr, keysAndArgs...)
 }
 
 func (r *redisCommands) LuaScript(script string, key string, args ...interface{}) (interface{}, error) {
-	return r.luaExecutor(script, key, args...)
+	return r.luaExecutor(r.ctx, script, key, args...)
 }
 
 func (r *redisCommands) Get(key string) (interface{}, error) {
-	return r.executor("GET", key)
+	return r.do("GET", key)
 }
 
 func (r *redisCommands) Set(key string, val interface{}) (interface{}, error) {
-	return r.executor("SET", key, val)
+	return r.do("SET", key, val)
 }
 
 func (r *redisCommands) SetEx(key string, val interface{}, timeExpire int64) (interface{}, error) {
-	return r.executor("SETEX", key, timeExpire, val)
+	return r.do("SETEX", key, timeExpire, val)
 }
 
 func (r *redisCommands) SetNx(key string, val interface{}) (interface{}, error) {
-	return r.executor("SETNX", key, val)
+	return r.do("SETNX", key, val)
 }
 
 func (r *redisCommands) SetNxEx(key string, val interface{}, timeExpire int) (interface{}, error) {
-	return r.executor("SET", key, val, "EX", timeExpire, "NX")
+	return r.do("SET", key, val, "EX", timeExpire, "NX")
 }
 
 func (r *redisCommands) Del(key string) (interface{}, error) {
-	return r.executor("DEL", key)
+	return r.do("DEL", key)
 }
 
 func (r *redisCommands) Exists(key string) (interface{}, error) {
-	return r.executor("EXISTS", key)
+	return r.do("EXISTS", key)
 }
 
 func (r *redisCommands) Expire(key string, timeInt int) error {
-	_, err := r.executor("EXPIRE", key, timeInt)
+	_, err := r.do("EXPIRE", key, timeInt)
 	return err
 }
 
 func (r *redisCommands) ExpireAt(key string, timestampInt int64) (interface{}, error) {
-	return r.executor("EXPIREAT", key, timestampInt)
+	return r.do("EXPIREAT", key, timestampInt)
 }
 
 func (r *redisCommands) Keys(pre_key string) (interface{}, error) {
-	return r.executor("KEYS", pre_key)
+	return r.do("KEYS", pre_key)
 }
 
 func (r *redisCommands) IncrBy(key string) (interface{}, error) {
-	return r.executor("INCR", key)
+	return r.do("INCR", key)
 }
 
 func (r *redisCommands) IncrbyVal(key string, val interface{}) (interface{}, error) {
-	return r.executor("INCRBY", key, val)
+	return r.do("INCRBY", key, val)
 }
 
 func (r *redisCommands) IncrbyFloat(key string, val interface{}) (interface{}, error) {
-	return r.executor("INCRBYFLOAT", key, val)
+	return r.do("INCRBYFLOAT", key, val)
 }
 
 func (r *redisCommands) DecrByNum(key string, num interface{}) (interface{}, error) {
-	return r.executor("DECRBY", key, num)
+	return r.do("DECRBY", key, num)
 }
 
 func (r *redisCommands) Hset(key string, field, val interface{}) (interface{}, error) {
-	return r.executor("HSET", key, field, val)
+	return r.do("HSET", key, field, val)
 }
 
 func (r *redisCommands) Hget(key string, field string) (interface{}, error) {
-	return r.executor("HGET", key, field)
+	return r.do("HGET", key, field)
 }
 
 func (r *redisCommands) HgetAll(key string) (interface{}, error) {
-	return r.executor("HGETALL", key)
+	return r.do("HGETALL", key)
 }
 
 func (r *redisCommands) Hdel(key string, field interface{}) (interface{}, error) {
-	return r.executor("HDEL", key, field)
+	return r.do("HDEL", key, field)
 }
 
 func (r *redisCommands) Hexists(key string, field interface{}) bool {
-	res, _ := redis.Int(r.executor("HEXISTS", key, field))
+	res, _ := redis.Int(r.do("HEXISTS", key, field))
 	return res == 1
 }
 
 func (r *redisCommands) HIncrby(key string, field string, val interface{}) (interface{}, error) {
-	return r.executor("HINCRBY", key, field, val)
+	return r.do("HINCRBY", key, field, val)
 }
 
 func (r *redisCommands) HMget(key string, fields []interface{}) (interface{}, error) {
 	args := make([]interface{}, 0)
 	args = append(args, key)
 	args = append(args, fields...)
-	return r.executor("HMGET", args...)
+	return r.do("HMGET", args...)
 }
 
 func (r *redisCommands) SAdd(key string, val interface{}) error {
-	_, err := r.executor("SADD", key, val)
+	_, err := r.do("SADD", key, val)
 	return err
 }
 
 func (r *redisCommands) SRem(key string, val interface{}) (interface{}, error) {
-	return r.executor("SREM", key, val)
+	return r.do("SREM", key, val)
 }
 
 func (r *redisCommands) SCard(key string) (interface{}, error) {
-	return r.executor("SCARD", key)
+	return r.do("SCARD", key)
 }
 
 func (r *redisCommands) SIsMember(key string, val interface{}) (bool, error) {
-	existsInt64, err := redis.Int64(r.executor("SISMEMBER", key, val))
+	existsInt64, err := redis.Int64(r.do("SISMEMBER", key, val))
 	if err != nil {
 		return false, err
 	}
@@ -205,28 +341,28 @@ func (r *redisCommands) SIsMember(key string, val interface{}) (bool, error) {
 }
 
 func (r *redisCommands) SMembers(key string) (interface{}, error) {
-	return r.executor("SMEMBERS", key)
+	return r.do("SMEMBERS", key)
 }
 
 func (r *redisCommands) ZAdd(key string, score, val interface{}) error {
-	_, err := r.executor("ZADD", key, score, val)
+	_, err := r.do("ZADD", key, score, val)
 	return err
 }
 
 func (r *redisCommands) ZAddBool(key string, score, val interface{}) (int, error) {
-	return redis.Int(r.executor("ZADD", key, score, val))
+	return redis.Int(r.do("ZADD", key, score, val))
 }
 
 func (r *redisCommands) ZRem(key string, val interface{}) (interface{}, error) {
-	return r.executor("ZREM", key, val)
+	return r.do("ZREM", key, val)
 }
 
 func (r *redisCommands) ZCard(key string) (interface{}, error) {
-	return r.executor("ZCARD", key)
+	return r.do("ZCARD", key)
 }
 
 func (r *redisCommands) ZScore(key string, val interface{}) (interface{}, error) {
-	return r.executor("ZSCORE", key, val)
+	return r.do("ZSCORE", key, val)
 }
 
 func (r *redisCommands) ZRange(key string, start, end int, withScore bool) (interface{}, error) {
@@ -234,7 +370,7 @@ func (r *redisCommands) ZRange(key string, start, end int, withScore bool) (inte
 	if withScore {
 		args = append(args, "WITHSCORES")
 	}
-	return r.executor("ZRANGE", args...)
+	return r.do("ZRANGE", args...)
 }
 
 func (r *redisCommands) ZRevRange(key string, start, end int, withScore bool) (interface{}, error) {
@@ -242,7 +378,7 @@ func (r *redisCommands) ZRevRange(key string, start, end int, withScore bool) (i
 	if withScore {
 		args = append(args, "WITHSCORES")
 	}
-	return r.executor("ZREVRANGE", args...)
+	return r.do("ZREVRANGE", args...)
 }
 
 func (r *redisCommands) ZRangeByScore(key string, start, end interface{}, withScore bool) (interface{}, error) {
@@ -250,85 +386,74 @@ func (r *redisCommands) ZRangeByScore(key string, start, end interface{}, withSc
 	if withScore {
 		args = append(args, "WITHSCORES")
 	}
-	return r.executor("ZRANGEBYSCORE", args...)
+	return r.do("ZRANGEBYSCORE", args...)
 }
 
 func (r *redisCommands) ZRevRank(key string, val interface{}) (interface{}, error) {
-	return r.executor("ZREVRANK", key, val)
+	return r.do("ZREVRANK", key, val)
 }
 
 func (r *redisCommands) ZIncrBy(key string, offset interface{}, val interface{}) (interface{}, error) {
-	return r.executor("ZINCRBY", key, offset, val)
+	return r.do("ZINCRBY", key, offset, val)
 }
 
+// zincrByExpireScript 在一个脚本中执行 ZINCRBY 和 EXPIRE，避免两次往返之间中断留下不过期的 key
+// KEYS: key  ARGV: increment, member, seconds
+var zincrByExpireScript = NewScript(`
+local score = redis.call("ZINCRBY", KEYS[1], ARGV[1], ARGV[2])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return score
+`)
+
 func (r *redisCommands) ZIncrByExpire(key string, offset interface{}, val interface{}, expireInt int) (interface{}, error) {
-	res, err := r.executor("ZINCRBY", key, offset, val)
-	if err != nil {
-		return nil, err
-	}
-	
-	// 设置过期时间，如果失败则记录错误但不影响主要操作的结果
-	_, expireErr := r.executor("EXPIRE", key, expireInt)
-	if expireErr != nil {
-		// 这里可以根据业务需求决定是否返回错误
-		// 目前保持向后兼容，只记录日志但不返回错误
-		// 可以考虑使用日志系统记录这个错误
-	}
-	
-	return res, err
+	return zincrByExpireScript.Run(r, []string{key}, offset, val, expireInt)
 }
 
 func (r *redisCommands) LPush(key string, val interface{}) (interface{}, error) {
-	return r.executor("LPUSH", key, val)
+	return r.do("LPUSH", key, val)
 }
 
 func (r *redisCommands) RPop(key string) (interface{}, error) {
-	return r.executor("RPOP", key)
+	return r.do("RPOP", key)
 }
 
 func (r *redisCommands) BRPop(key string, timeout int) (interface{}, error) {
-	return r.executor("BRPOP", key, timeout)
+	return r.doBlock(time.Duration(timeout)*time.Second, "BRPOP", key, timeout)
 }
 
 func (r *redisCommands) LLen(key string) (interface{}, error) {
-	return r.executor("LLEN", key)
+	return r.do("LLEN", key)
 }
 
 func (r *redisCommands) SetBit(key string, offset, val interface{}) (interface{}, error) {
-	return r.executor("SETBIT", key, offset, val)
+	return r.do("SETBIT", key, offset, val)
 }
 
 func (r *redisCommands) GetBit(key string, offset interface{}) (interface{}, error) {
-	return r.executor("GETBIT", key, offset)
+	return r.do("GETBIT", key, offset)
 }
 
 func (r *redisCommands) BitCount(key string) (interface{}, error) {
-	return r.executor("BITCOUNT", key)
+	return r.do("BITCOUNT", key)
+}
+
+func (r *redisCommands) Publish(channel string, message interface{}) (int64, error) {
+	return redis.Int64(r.do("PUBLISH", channel, message))
 }
 
+func (r *redisCommands) SPublish(channel string, message interface{}) (int64, error) {
+	return redis.Int64(r.do("SPUBLISH", channel, message))
+}
+
+// DelPattern 使用 SCAN 遍历并逐个删除匹配的 key，集群模式下每个 key 可能位于不同的槽
 func (r *redisCommands) DelPattern(patternKey string) error {
-	cursor := "0"
-	for {
-		values, err := redis.Values(r.executor("SCAN", cursor, "MATCH", patternKey))
-		if err != nil {
+	it := Scan(r.ctx, r, WithScanMatch(patternKey))
+	for it.Next() {
+		if _, err := r.do("DEL", it.Val()); err != nil {
 			return err
 		}
-		
-		cursor, _ = redis.String(values[0], nil)
-		keys, _ := redis.Strings(values[1], nil)
-		
-		for _, key := range keys {
-			_, err = r.executor("DEL", key)
-			if err != nil {
-				return err
-			}
-		}
-		
-		if cursor == "0" {
-			break
-		}
 	}
-	return nil
+	return it.Err()
 }
 
 // 缓存相关类型和函数
@@ -336,56 +461,16 @@ type FuncType func() ([]byte, error)
 type FuncTypeInt func() ([]byte, int64, error)
 
 // CallBackMsgpackCacheWithCommander 带缓存的回调函数，使用指定的命令实例
+// 同一进程内相同 key 的回源会合并为一次，需要更多控制时使用 CallBackCacheWithCommander
 func CallBackMsgpackCacheWithCommander(commander RedisCommander, redisKey string, funcs FuncType, opt ...int64) ([]byte, error) {
-	existsInt, _ := redis.Int(commander.Exists(redisKey))
-	if existsInt == 0 {
-		res, err := funcs()
-		if err != nil {
-			return nil, err
-		}
-		if res == nil {
-			return nil, errors.New("data is null")
-		}
-		var timeOut int64 = 86400
-		if len(opt) > 0 {
-			timeOut = opt[0]
-		}
-		commander.SetEx(redisKey, res, timeOut)
-		return res, nil
-	} else {
-		bytesRes, err := redis.Bytes(commander.Get(redisKey))
-		if err != nil {
-			return nil, err
-		}
-		return bytesRes, nil
+	var timeOut int64 = 86400
+	if len(opt) > 0 {
+		timeOut = opt[0]
 	}
+	return CallBackCacheWithCommander(commander, redisKey, funcs, WithCacheTTL(time.Duration(timeOut)*time.Second))
 }
 
 // CallBackMsgpackCacheInWithCommander 带内部时间控制的缓存回调函数，使用指定的命令实例
 func CallBackMsgpackCacheInWithCommander(commander RedisCommander, redisKey string, funcs FuncTypeInt) ([]byte, error) {
-	existsInt, _ := redis.Int(commander.Exists(redisKey))
-	if existsInt == 0 {
-		res, timeOut, err := funcs()
-		if err != nil {
-			return nil, err
-		}
-		if res == nil {
-			return nil, errors.New("data is null")
-		}
-		
-		_, err = commander.Set(redisKey, res)
-		if err != nil {
-			return nil, err
-		}
-		if timeOut > 0 {
-			commander.ExpireAt(redisKey, timeOut)
-		}
-		return res, nil
-	} else {
-		bytesRes, err := redis.Bytes(commander.Get(redisKey))
-		if err != nil {
-			return nil, err
-		}
-		return bytesRes, nil
-	}
-}
\ No newline at end of file
+	return CallBackCacheInWithCommander(commander, redisKey, funcs)
+}
@@ -1,6 +1,7 @@
 package zredis
 
 import (
+	"context"
 	"github.com/garyburd/redigo/redis"
 	"testing"
 )
@@ -838,6 +839,20 @@ func testZSetOperations(t *testing.T, commander RedisCommander) {
 	if err != nil {
 		t.Errorf("ZRevRange failed: %v", err)
 	}
+
+	// ZIncrByExpire 同时设置过期时间
+	expireKey := "test:zset:expire"
+	score, err = commander.ZIncrByExpire(expireKey, 5, "player1", 60)
+	if err != nil {
+		t.Errorf("ZIncrByExpire failed: %v", err)
+	}
+	if scoreStr, _ = redis.String(score, nil); scoreStr != "5" {
+		t.Errorf("Expected score '5', got %v", scoreStr)
+	}
+	ttl, err := redis.Int(commander.Cmd("TTL", expireKey))
+	if err != nil || ttl <= 0 || ttl > 60 {
+		t.Errorf("Expected ttl in (0, 60], got %d, %v", ttl, err)
+	}
 }
 
 // 测试List操作
@@ -951,3 +966,48 @@ func testLuaScript(t *testing.T, commander RedisCommander) {
 		t.Errorf("Expected 'test_value', got %v", resultStr)
 	}
 }
+
+// Context Tests
+func TestRedisCommands_WithContext(t *testing.T) {
+	type ctxKey struct{}
+	var gotCtx context.Context
+	commander := NewRedisCommandsCtx(
+		func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+			gotCtx = ctx
+			return "OK", nil
+		},
+		func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+			gotCtx = ctx
+			return []interface{}{1}, nil
+		},
+	)
+	if commander.Context() != context.Background() {
+		t.Errorf("Expected background context by default")
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	bound := commander.WithContext(ctx)
+	if _, err := bound.Get("test:key1"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if gotCtx != ctx {
+		t.Errorf("Expected bound context to be passed to executor")
+	}
+	if _, err := bound.LuaScript("return 1", "test:lua"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if gotCtx != ctx {
+		t.Errorf("Expected bound context to be passed to lua executor")
+	}
+
+	// 原实例不受影响
+	commander.Get("test:key1")
+	if gotCtx != context.Background() {
+		t.Errorf("Expected original commander to keep background context")
+	}
+
+	// nil ctx 视为 context.Background()
+	if _, err := commander.WithContext(nil).Get("test:key1"); err != nil || gotCtx != context.Background() {
+		t.Errorf("Expected nil context to be treated as background, got %v %v", gotCtx, err)
+	}
+}
@@ -1,149 +1,280 @@
 package zredis
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/garyburd/redigo/redis"
-	"log"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrDial 建立 TCP/TLS 连接失败
+	ErrDial = errors.New("zredis: dial failed")
+	// ErrAuth 认证失败，包括 CredentialsProvider 返回错误
+	ErrAuth = errors.New("zredis: auth failed")
+	// ErrSelectDB 选择数据库失败
+	ErrSelectDB = errors.New("zredis: select db failed")
+	// ErrNotConnected 全局连接池还未初始化
+	ErrNotConnected = errors.New("zredis: redis pool not initialized, call Conn first")
+)
+
+// ConnError 建立连接失败的错误，可以用 errors.Is(err, ErrAuth) 区分失败阶段，
+// errors.As 获取底层的网络错误或 redis.Error
+type ConnError struct {
+	// Kind 为 ErrDial、ErrAuth 或 ErrSelectDB
+	Kind error
+	Addr string
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("%v %s: %v", e.Kind, e.Addr, e.Err)
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConnError) Is(target error) bool {
+	return target == e.Kind
+}
+
 type RedisPool struct {
-	redis_pool  *redis.Pool
-	maxActive   int
-	maxIdle     int
-	idleTime    time.Duration
-	redisOption []redis.DialOption
+	redis_pool *redis.Pool
+	config     *PoolConfig
+	codec      Codec
+	db         int
 }
 type Redis_func func(*RedisPool)
 
-var redisPool *RedisPool
+// redisPool 全局连接池，Conn、ConnSentinel 和 ConnURL 可以在执行命令的同时替换
+var redisPool atomic.Pointer[RedisPool]
 
-func Conn(conn, auth string, dbnum int, opts ...Redis_func) {
+// replaceTimeout 替换全局连接池后等待旧连接池上执行中命令的最长时间
+const replaceTimeout = 10 * time.Second
 
-	redisPool = &RedisPool{
-		maxActive: 100,
-		maxIdle:   50,
-		idleTime:  300 * time.Second,
+// setGlobalPool 替换全局连接池，旧的连接池在后台优雅关闭，超过 replaceTimeout 后强制关闭
+func setGlobalPool(r *RedisPool) {
+	old := redisPool.Swap(r)
+	if old == nil || old.redis_pool == nil {
+		return
 	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), replaceTimeout)
+		defer cancel()
+		old.config.Tracker.Shutdown(ctx, old.redis_pool)
+	}()
+}
+
+// globalPool 返回已经初始化的全局连接池
+func globalPool() (*RedisPool, bool) {
+	r := redisPool.Load()
+	return r, r != nil && r.redis_pool != nil
+}
+
+// Conn 创建全局连接池，连接、认证或选库失败时返回 *ConnError，全局连接池保持不变
+// 成功后替换已有的全局连接池，旧连接池等待执行中的命令结束后关闭
+func Conn(conn, auth string, dbnum int, opts ...Redis_func) error {
+	r := newRedisPool(opts...)
+	r.db = dbnum
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial(conn, auth, dbnum)
+	})
+	if err := r.start(pool); err != nil {
+		return err
+	}
+	setGlobalPool(r)
+	return nil
+}
+
+// ConnSentinel 通过哨兵发现主节点并创建全局连接池，主从切换后自动连接新的主节点
+func ConnSentinel(masterName string, sentinelAddrs []string, auth string, dbnum int, opts ...Redis_func) error {
+	r := newRedisPool(opts...)
+	r.db = dbnum
+	r.config.Sentinel = NewSentinel(masterName, sentinelAddrs)
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Sentinel.Dial(func(addr string) (redis.Conn, error) {
+			return r.config.Dial(addr, auth, dbnum)
+		})
+	})
+	if err := r.start(pool); err != nil {
+		return err
+	}
+	setGlobalPool(r)
+	return nil
+}
+
+func newRedisPool(opts ...Redis_func) *RedisPool {
+	r := &RedisPool{config: NewPoolConfig()}
 
 	for _, opt := range opts {
-		opt(redisPool)
-	}
-	optionDefalt := []redis.DialOption{
-		redis.DialConnectTimeout(time.Duration(5) * time.Second),
-		redis.DialReadTimeout(time.Duration(10) * time.Second),
-		redis.DialWriteTimeout(time.Duration(10) * time.Second),
-	}
-	if len(redisPool.redisOption) > 0 {
-		optionDefalt = append(optionDefalt, redisPool.redisOption...)
-	}
-	pool := &redis.Pool{
-		MaxActive:   redisPool.maxActive, // 最大活跃 假设应用在高并发场景下，最大并发请求数为 1000，那么可以将 MaxActive 设置为 2000-3000。
-		MaxIdle:     redisPool.maxIdle,   // 最大空闲 ,一般启动时候保持的链接数
-		IdleTimeout: redisPool.idleTime,  // 空闲连接超时 超过这个时间会关闭空闲链接
-		Wait:        false,               // true: 如果达到最大连接数，等待空闲连接 false: 直接返回错误
-		Dial: func() (redis.Conn, error) {
-
-			c, err := redis.Dial(
-				"tcp",
-				conn,
-				optionDefalt...,
-			)
-			if err != nil {
-				//zlog.F().Error("Redis Redis 连接错误", err)
-				return nil, err
-			}
-			//验证redis 是否有密码
-			if auth != "" {
-				if _, err := c.Do("AUTH", auth); err != nil {
-
-					c.Close()
-					//zlog.F().Fatalf("Connect to redis AUTH error: %v", err)
-					log.Println("Connect to redis AUTH error:", err)
-					return nil, err
-				}
-			}
-			c.Do("select", dbnum)
-
-			return c, nil
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
-			}
-			_, err := c.Do("PING")
-			return err
-		},
-	}
-	c := pool.Get()
-	if c.Err() != nil {
-		//zlog.F().Fatalf("conn:%s,err:%v", conn, c.Err())
-		log.Println("conn:%s,err:%v", conn, c.Err())
-		return
+		opt(r)
 	}
-	c.Close()
-	redisPool.redis_pool = pool
+	return r
+}
 
+// start 检查连接并预加载脚本，成功后启用 pool
+// 开启 WithLazyConnect 时失败不返回错误，在后台重试直到连接成功
+func (r *RedisPool) start(pool *redis.Pool) error {
+	r.redis_pool = pool
+	return r.config.Start(pool)
 }
 
 // WithMaxActive 设置最大活跃
 func WithMaxActive(maxActive int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxActive = maxActive
+		r.config.MaxActive = maxActive
 	}
 }
 
 // WithMaxIdle 设置最大空闲
 func WithMaxIdle(maxIdle int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxIdle = maxIdle
+		r.config.MaxIdle = maxIdle
 	}
 }
 
 // WithIdleTime 设置空闲连接超时时间
 func WithIdleTime(idleTime time.Duration) Redis_func {
 	return func(r *RedisPool) {
-		r.idleTime = idleTime
+		r.config.IdleTimeout = idleTime
 	}
 }
 
-// WithRedisOption 设置redis连接选项
+// WithRedisOption 追加redis连接选项，不会覆盖 WithRedisTLS 和 ConnURL 地址参数中的选项，同一选项后追加的生效
 func WithRedisOption(opts ...redis.DialOption) Redis_func {
 	return func(r *RedisPool) {
-		r.redisOption = opts
+		r.config.DialOptions = append(r.config.DialOptions, opts...)
 	}
 }
 
 // WithRedisTLS 设置redis连接是否使用TLS
 func WithRedisTLS() Redis_func {
 	return func(r *RedisPool) {
-		r.redisOption = append(r.redisOption, redis.DialUseTLS(true), redis.DialTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+		r.config.DialOptions = append(r.config.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(&tls.Config{InsecureSkipVerify: true}))
 	}
 }
 
-func CommonCmd(cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
-	c := redisPool.redis_pool.Get()
-	if c.Err() != nil {
-		//zlog.F().Errorf("Redis DoCommonCmd: %v", c.Err())
-		return nil, c.Err()
+// WithRedisTLSConfig 使用自定义的TLS配置连接
+func WithRedisTLSConfig(tlsConfig *tls.Config) Redis_func {
+	return func(r *RedisPool) {
+		r.config.DialOptions = append(r.config.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
 	}
-	defer c.Close()
-	res, err := c.Do(cmdStr, keysAndArgs...)
-	if err == nil {
-		return res, err
+}
+
+// WithUsername 设置 Redis 6 ACL 用户名，与密码一起使用 AUTH username password 认证
+func WithUsername(username string) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Username = username
+	}
+}
+
+// WithHelloAuth 使用 HELLO 2 AUTH 认证，服务端不支持 HELLO 时回退到 AUTH
+func WithHelloAuth() Redis_func {
+	return func(r *RedisPool) {
+		r.config.Hello = true
 	}
-	return nil, err
+}
+
+// WithCredentialsProvider 每次建立新连接时调用 provider 获取用户名和密码，覆盖 Conn 传入的密码和 WithUsername
+func WithCredentialsProvider(provider CredentialsProvider) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Credentials = provider
+	}
+}
+
+// WithWait 连接数达到 MaxActive 时等待空闲连接，默认 false 直接返回 redis.ErrPoolExhausted
+// 等待时间受 ctx 控制，等待次数和时间见 Stats
+func WithWait(wait bool) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Wait = wait
+	}
+}
+
+// WithLazyConnect 启动时连接失败不返回错误，每隔 retryInterval（指数退避）在后台重试直到连接成功，
+// 期间执行命令会返回连接错误，retryInterval <= 0 时为 1 秒
+func WithLazyConnect(retryInterval time.Duration) Redis_func {
+	return func(r *RedisPool) {
+		if retryInterval <= 0 {
+			retryInterval = time.Second
+		}
+		r.config.LazyRetry = retryInterval
+	}
+}
+
+// WithScripts 连接时使用 SCRIPT LOAD 预加载Lua脚本
+func WithScripts(scripts ...*Script) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Scripts = append(r.config.Scripts, scripts...)
+	}
+}
+
+// WithCodec 设置 SetObject/GetObject 等对象读写使用的编解码器，默认 JSONCodec
+func WithCodec(codec Codec) Redis_func {
+	return func(r *RedisPool) {
+		r.codec = codec
+	}
+}
+
+func CommonCmd(cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	return CommonCmdCtx(context.Background(), cmdStr, keysAndArgs...)
+}
+
+// CommonCmdCtx 执行通用的 Redis 命令，遵守ctx的取消与截止时间
+func CommonCmdCtx(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	c, err := getConn(ctx)
+	if err != nil {
+		//zlog.F().Errorf("Redis DoCommonCmd: %v", err)
+		return nil, err
+	}
+	return DoContext(ctx, c, cmdStr, keysAndArgs...)
 }
 
 func CommonLuaScript(script string, key string, args ...interface{}) (reply interface{}, err error) {
-	c := redisPool.redis_pool.Get()
-	if c.Err() != nil {
-		//zlog.F().Errorf("LuaCommonCmd get redis error: %v", c.Err())
+	return CommonLuaScriptCtx(context.Background(), script, key, args...)
+}
 
-		return
+// CommonLuaScriptCtx 执行 Lua 脚本命令，遵守ctx的取消与截止时间
+func CommonLuaScriptCtx(ctx context.Context, script string, key string, args ...interface{}) (reply interface{}, err error) {
+	c, err := getConn(ctx)
+	if err != nil {
+		//zlog.F().Errorf("LuaCommonCmd get redis error: %v", err)
+		return nil, err
 	}
-	defer c.Close()
 
-	lua := redis.NewScript(1, script)
-	return lua.Do(c, append([]interface{}{key}, args...)...)
+	lua := CachedScript(script)
+	return RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+		return lua.Do(c, []string{key}, args...)
+	})
+}
+
+// getConn 从全局连接池获取连接
+func getConn(ctx context.Context) (redis.Conn, error) {
+	r, ok := globalPool()
+	if !ok {
+		return nil, ErrNotConnected
+	}
+	return r.config.Tracker.Get(ctx, r.redis_pool)
+}
+
+// Close 关闭全局连接池，拒绝新的命令并立即关闭所有连接，正在执行的命令会返回错误
+func Close() error {
+	r, ok := globalPool()
+	if !ok {
+		return nil
+	}
+	return r.config.Tracker.Close(r.redis_pool)
+}
+
+// Shutdown 优雅关闭全局连接池：拒绝新的命令，立即关闭 Subscriber 等持有的订阅连接，等待执行中的命令（包括 BRPOP 等阻塞命令）结束后关闭连接，
+// ctx 结束时强制关闭剩余连接并返回 ctx.Err()
+func Shutdown(ctx context.Context) error {
+	r, ok := globalPool()
+	if !ok {
+		return nil
+	}
+	return r.config.Tracker.Shutdown(ctx, r.redis_pool)
 }
@@ -1,6 +1,7 @@
 package zredis_test
 
 import (
+	"errors"
 	"github.com/Xuzan9396/zredis"
 	"github.com/garyburd/redigo/redis"
 	"testing"
@@ -35,7 +36,11 @@ func TestRedisPool_CommonCmd(t *testing.T) {
 	conn := "127.0.0.1:6379"
 	passwd := "27252725"
 	dbnum := 0
-	zredis.Conn(conn, passwd, dbnum, zredis.WithIdleTime(60*time.Second))
+	if err := zredis.Conn(conn, passwd, dbnum, zredis.WithIdleTime(60*time.Second)); errors.Is(err, zredis.ErrDial) {
+		t.Skipf("redis not available: %v", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
 	zredis.CommonHset("test_lua_hset", "coin", 100)
 	zredis.CommonHset("test_lua_hset", "coin_free", 10)
 	resBytes, err := redis.Values(zredis.CommonLuaScript(GIFT_DRAW_POOL, "test_lua_hset", 2))
@@ -0,0 +1,114 @@
+package zredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// connAborter 可以从其他 goroutine 中断正在执行的命令，本包连接池借出的连接都实现了该接口
+type connAborter interface {
+	abort() bool
+}
+
+// connObserver 统计被 ctx 取消或超时的命令，本包连接池借出的连接都实现了该接口
+type connObserver interface {
+	observe(err error)
+}
+
+// connDedicator 可以标记为长期占用的专用连接（订阅、失效通知），Shutdown 不等待其归还而是直接关闭
+type connDedicator interface {
+	dedicate()
+}
+
+// dedicateConn 把 c 标记为专用连接，c 不支持时（如自定义 ConnGetter 返回的连接）忽略
+func dedicateConn(c redis.Conn) {
+	if d, ok := c.(connDedicator); ok {
+		d.dedicate()
+	}
+}
+
+// RunContext 在连接c上执行fn，并在结束后关闭c（归还连接池）
+// ctx 被取消或超时时关闭底层连接中断 BRPOP、XREAD、Lua 等正在等待的命令，等 fn 返回后返回 ctx.Err()，
+// 被中断的连接不会放回连接池；c 不支持中断时（如自定义 ConnGetter 返回的连接）立即返回，fn 在后台执行完毕后再归还连接
+func RunContext(ctx context.Context, c redis.Conn, fn func(c redis.Conn) (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		observeConn(c, err)
+		c.Close()
+		return nil, err
+	}
+	// 不可取消的context直接执行，避免额外的goroutine开销
+	if ctx.Done() == nil {
+		defer c.Close()
+		return fn(c)
+	}
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := fn(c)
+		c.Close()
+		done <- result{reply, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.reply, res.err
+	case <-ctx.Done():
+		observeConn(c, ctx.Err())
+		if a, ok := c.(connAborter); ok && a.abort() {
+			<-done
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// observeConn 把 ctx 错误计入 c 所属连接池的统计
+func observeConn(c redis.Conn, err error) {
+	if o, ok := c.(connObserver); ok {
+		o.observe(err)
+	}
+}
+
+// blockTimeoutMargin 阻塞命令的读超时在阻塞时间之外留出的余量
+const blockTimeoutMargin = 5 * time.Second
+
+type blockTimeoutKey struct{}
+
+// withBlockTimeout 标记在 ctx 上执行的命令最多阻塞 block 时间（BLMOVE、XREAD BLOCK 等），block <= 0 表示一直阻塞，
+// DoContext 据此放宽读超时，避免阻塞超过连接默认读超时（10 秒）时被中断
+func withBlockTimeout(ctx context.Context, block time.Duration) context.Context {
+	return context.WithValue(ctx, blockTimeoutKey{}, block)
+}
+
+// DoContext 在连接c上执行单条命令，并在结束后关闭c（归还连接池）
+// ctx 带截止时间时，读超时按剩余时间设置，超时的连接会被连接池丢弃
+func DoContext(ctx context.Context, c redis.Conn, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	return RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+		// timeout 为 0 时 DoWithTimeout 不设置读超时
+		timeout, withTimeout := time.Duration(0), false
+		if block, ok := ctx.Value(blockTimeoutKey{}).(time.Duration); ok {
+			withTimeout = true
+			if block > 0 {
+				timeout = block + blockTimeoutMargin
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return nil, context.DeadlineExceeded
+			}
+			if !withTimeout || timeout == 0 || remaining < timeout {
+				timeout, withTimeout = remaining, true
+			}
+		}
+		if withTimeout {
+			return redis.DoWithTimeout(c, timeout, cmdStr, keysAndArgs...)
+		}
+		return c.Do(cmdStr, keysAndArgs...)
+	})
+}
@@ -0,0 +1,120 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 模拟的连接，Do 会阻塞到 release 关闭
+type blockingConn struct {
+	release chan struct{}
+	closed  chan struct{}
+	timeout time.Duration
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{release: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (c *blockingConn) Close() error                      { close(c.closed); return nil }
+func (c *blockingConn) Err() error                        { return nil }
+func (c *blockingConn) Send(string, ...interface{}) error { return nil }
+func (c *blockingConn) Flush() error                      { return nil }
+func (c *blockingConn) Receive() (interface{}, error)     { return nil, nil }
+func (c *blockingConn) Do(string, ...interface{}) (interface{}, error) {
+	<-c.release
+	return "OK", nil
+}
+func (c *blockingConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	c.timeout = timeout
+	return "OK", nil
+}
+func (c *blockingConn) ReceiveWithTimeout(time.Duration) (interface{}, error) { return nil, nil }
+
+func TestDoContext_Background(t *testing.T) {
+	c := newBlockingConn()
+	close(c.release)
+	res, err := DoContext(context.Background(), c, "PING")
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if res != "OK" {
+		t.Errorf("Expected 'OK', got %v", res)
+	}
+	select {
+	case <-c.closed:
+	default:
+		t.Errorf("Expected connection to be closed")
+	}
+}
+
+func TestDoContext_Cancel(t *testing.T) {
+	c := newBlockingConn()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := DoContext(ctx, c, "BRPOP", "test:list", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// 命令返回后连接才会被归还
+	close(c.release)
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second):
+		t.Errorf("Expected connection to be closed after command finished")
+	}
+}
+
+func TestDoContext_Deadline(t *testing.T) {
+	c := newBlockingConn()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := DoContext(ctx, c, "GET", "test:key1"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if c.timeout <= 0 || c.timeout > time.Second {
+		t.Errorf("Expected read timeout derived from deadline, got %v", c.timeout)
+	}
+}
+
+func TestDoContext_AlreadyDone(t *testing.T) {
+	c := newBlockingConn()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := DoContext(ctx, c, "GET", "test:key1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+var _ redis.ConnWithTimeout = (*blockingConn)(nil)
+
+func TestRunContext_AbortPooledConn(t *testing.T) {
+	r := newTrackedTestPool(t)
+	c, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = DoContext(ctx, c, "BRPOP", "test:context:abort", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("BRPOP not interrupted, took %v", d)
+	}
+	if stats := r.config.Tracker.Stats(r.redis_pool); stats.InUseCount != 0 || stats.ActiveCount != 0 {
+		t.Errorf("Expected aborted connection released and discarded, got %+v", stats)
+	}
+}
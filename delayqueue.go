@@ -0,0 +1,248 @@
+package zredis
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// delayScheduleScript 写入任务内容和到期时间，相同 id 会覆盖
+// KEYS: delayed, payloads  ARGV: id, due(ms), body
+var delayScheduleScript = NewScript(`
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[3])
+return redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+`)
+
+// delayClaimScript 原子领取到期任务，ZRANGEBYSCORE 和 ZREM 在同一个脚本中，多个消费者不会重复领取
+// KEYS: delayed, payloads  ARGV: now(ms), limit
+// 返回 {id, due, body, id, due, body, ...}
+var delayClaimScript = NewScript(`
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "WITHSCORES", "LIMIT", 0, tonumber(ARGV[2]))
+local res = {}
+for i = 1, #items, 2 do
+	local id = items[i]
+	redis.call("ZREM", KEYS[1], id)
+	local body = redis.call("HGET", KEYS[2], id)
+	redis.call("HDEL", KEYS[2], id)
+	if body then
+		table.insert(res, id)
+		table.insert(res, items[i + 1])
+		table.insert(res, body)
+	end
+end
+return res
+`)
+
+// delayCancelScript 删除任务，返回是否存在
+// KEYS: delayed, payloads  ARGV: id
+var delayCancelScript = NewScript(`
+redis.call("HDEL", KEYS[2], ARGV[1])
+return redis.call("ZREM", KEYS[1], ARGV[1])
+`)
+
+// delayRescheduleScript 修改已存在任务的到期时间，返回是否存在
+// KEYS: delayed  ARGV: id, due(ms)
+var delayRescheduleScript = NewScript(`
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+type delayQueueOptions struct {
+	batchSize    int
+	pollInterval time.Duration
+	retryDelay   time.Duration
+}
+
+// DelayQueue_func 延迟队列的配置选项
+type DelayQueue_func func(*delayQueueOptions)
+
+// WithDelayQueueBatchSize 设置每次领取的最大任务数，默认 10
+func WithDelayQueueBatchSize(n int) DelayQueue_func {
+	return func(o *delayQueueOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithDelayQueuePollInterval 设置没有到期任务时的最长轮询间隔，默认 1 秒
+func WithDelayQueuePollInterval(interval time.Duration) DelayQueue_func {
+	return func(o *delayQueueOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// WithDelayQueueRetry 设置 Run 中处理失败的任务延迟多久重试，默认 10 秒，0 表示不重试
+func WithDelayQueueRetry(delay time.Duration) DelayQueue_func {
+	return func(o *delayQueueOptions) {
+		o.retryDelay = delay
+	}
+}
+
+// DelayedJob 延迟任务
+type DelayedJob struct {
+	ID   string
+	Body []byte
+	// Due 到期时间
+	Due time.Time
+}
+
+// DelayQueue 基于有序集合的延迟队列，分数为到期时间（毫秒），任务内容保存在哈希中
+// 所有 key 使用 {name} 哈希标签，集群模式下位于同一个槽
+type DelayQueue struct {
+	commander RedisCommander
+	name      string
+	opts      delayQueueOptions
+}
+
+// NewDelayQueue 创建基于全局连接池的延迟队列
+func NewDelayQueue(name string, opts ...DelayQueue_func) *DelayQueue {
+	initGlobalCommander()
+	return NewDelayQueueWithCommander(globalCommander, name, opts...)
+}
+
+// NewDelayQueueWithCommander 使用指定的命令实例创建延迟队列
+func NewDelayQueueWithCommander(commander RedisCommander, name string, opts ...DelayQueue_func) *DelayQueue {
+	q := &DelayQueue{
+		commander: commander,
+		name:      name,
+		opts: delayQueueOptions{
+			batchSize:    10,
+			pollInterval: time.Second,
+			retryDelay:   10 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(&q.opts)
+	}
+	return q
+}
+
+func (q *DelayQueue) keys() []string {
+	return []string{"{" + q.name + "}:delayed", "{" + q.name + "}:payloads"}
+}
+
+// Schedule 添加在 at 时间到期的任务，返回随机生成的任务 id
+func (q *DelayQueue) Schedule(ctx context.Context, body []byte, at time.Time) (string, error) {
+	id := randomToken()
+	return id, q.ScheduleID(ctx, id, body, at)
+}
+
+// ScheduleAfter 添加 delay 之后到期的任务
+func (q *DelayQueue) ScheduleAfter(ctx context.Context, body []byte, delay time.Duration) (string, error) {
+	return q.Schedule(ctx, body, time.Now().Add(delay))
+}
+
+// ScheduleID 使用指定 id 添加任务，id 已存在时覆盖内容和到期时间
+func (q *DelayQueue) ScheduleID(ctx context.Context, id string, body []byte, at time.Time) error {
+	_, err := delayScheduleScript.Run(commanderWithContext(q.commander, ctx), q.keys(), id, at.UnixMilli(), body)
+	return err
+}
+
+// Cancel 取消任务，返回任务是否存在
+func (q *DelayQueue) Cancel(ctx context.Context, id string) (bool, error) {
+	n, err := redis.Int(delayCancelScript.Run(commanderWithContext(q.commander, ctx), q.keys(), id))
+	return n > 0, err
+}
+
+// Reschedule 修改任务的到期时间，返回任务是否存在
+func (q *DelayQueue) Reschedule(ctx context.Context, id string, at time.Time) (bool, error) {
+	n, err := redis.Int(delayRescheduleScript.Run(commanderWithContext(q.commander, ctx), q.keys()[:1], id, at.UnixMilli()))
+	return n > 0, err
+}
+
+// Len 返回等待中的任务数
+func (q *DelayQueue) Len(ctx context.Context) (int, error) {
+	return redis.Int(commanderWithContext(q.commander, ctx).ZCard(q.keys()[0]))
+}
+
+// Claim 领取最多 limit 个已到期的任务，领取后任务从队列中删除
+// ctx 在执行中途结束时脚本可能已经执行，已领取的任务不会返回，需要不丢任务时传入不会取消的 ctx
+func (q *DelayQueue) Claim(ctx context.Context, limit int) ([]*DelayedJob, error) {
+	values, err := redis.Values(delayClaimScript.Run(commanderWithContext(q.commander, ctx), q.keys(), time.Now().UnixMilli(), limit))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*DelayedJob, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		id, _ := redis.String(values[i], nil)
+		due, _ := redis.Int64(values[i+1], nil)
+		body, _ := redis.Bytes(values[i+2], nil)
+		jobs = append(jobs, &DelayedJob{ID: id, Body: body, Due: time.UnixMilli(due)})
+	}
+	return jobs, nil
+}
+
+// nextDue 返回最早到期任务的到期时间，队列为空时返回 ErrNil
+func (q *DelayQueue) nextDue(ctx context.Context) (time.Time, error) {
+	// WITHSCORES 回复为 [member, score]
+	values, err := redis.Values(commanderWithContext(q.commander, ctx).ZRange(q.keys()[0], 0, 0, true))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(values) < 2 {
+		return time.Time{}, ErrNil
+	}
+	due, err := redis.Int64(values[1], nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(due), nil
+}
+
+// Run 循环领取并处理到期任务，没有到期任务时等待到最早的到期时间（不超过轮询间隔）
+// handler 返回错误时按 WithDelayQueueRetry 延迟重试；ctx 结束后等待当前任务处理完，把已领取未处理的任务放回队列后返回
+func (q *DelayQueue) Run(ctx context.Context, handler func(ctx context.Context, job *DelayedJob) error) error {
+	bg := context.Background()
+	for ctx.Err() == nil {
+		// 领取脚本不绑定 ctx：中断连接时脚本可能已在服务端执行，领取的任务会丢失，只在两批之间检查 ctx
+		jobs, err := q.Claim(bg, q.opts.batchSize)
+		if err != nil {
+			log.Printf("delay queue %s claim err:%v", q.name, err)
+		}
+		for i, job := range jobs {
+			if ctx.Err() != nil {
+				q.restore(bg, jobs[i:])
+				break
+			}
+			if err := handler(ctx, job); err != nil {
+				if q.opts.retryDelay <= 0 {
+					log.Printf("delay queue %s job %s err:%v", q.name, job.ID, err)
+					continue
+				}
+				if err := q.ScheduleID(bg, job.ID, job.Body, time.Now().Add(q.opts.retryDelay)); err != nil {
+					log.Printf("delay queue %s retry job %s err:%v", q.name, job.ID, err)
+				}
+			}
+		}
+		if len(jobs) > 0 && err == nil {
+			continue
+		}
+
+		wait := q.opts.pollInterval
+		if due, err := q.nextDue(ctx); err == nil {
+			if d := time.Until(due); d < wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// restore 把已领取未处理的任务按原到期时间放回队列
+func (q *DelayQueue) restore(ctx context.Context, jobs []*DelayedJob) {
+	for _, job := range jobs {
+		if err := q.ScheduleID(ctx, job.ID, job.Body, job.Due); err != nil {
+			log.Printf("delay queue %s restore job %s err:%v", q.name, job.ID, err)
+		}
+	}
+}
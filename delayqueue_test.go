@@ -0,0 +1,153 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDelayQueue(t *testing.T, opts ...DelayQueue_func) *DelayQueue {
+	commander, _ := newRedisTestCommander(t)
+	q := NewDelayQueueWithCommander(commander, "test:delay:"+t.Name(), opts...)
+	cleanup := func() {
+		for _, key := range q.keys() {
+			commander.Del(key)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return q
+}
+
+func TestDelayQueue_Claim(t *testing.T) {
+	q := newTestDelayQueue(t)
+	ctx := context.Background()
+	now := time.Now()
+	dueID, err := q.Schedule(ctx, []byte("due"), now.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("Schedule err: %v", err)
+	}
+	q.Schedule(ctx, []byte("later"), now.Add(time.Hour))
+
+	jobs, err := q.Claim(ctx, 10)
+	if err != nil {
+		t.Fatalf("Claim err: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != dueID || string(jobs[0].Body) != "due" {
+		t.Fatalf("Unexpected jobs %+v", jobs)
+	}
+	if jobs[0].Due.UnixMilli() != now.Add(-time.Second).UnixMilli() {
+		t.Errorf("Unexpected due %v", jobs[0].Due)
+	}
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 0 {
+		t.Errorf("Expected due job to be claimed once, got %+v", jobs)
+	}
+	if n, _ := q.Len(ctx); n != 1 {
+		t.Errorf("Expected 1 pending job, got %d", n)
+	}
+}
+
+func TestDelayQueue_CancelReschedule(t *testing.T) {
+	q := newTestDelayQueue(t)
+	ctx := context.Background()
+	id, _ := q.ScheduleAfter(ctx, []byte("a"), time.Hour)
+
+	ok, err := q.Reschedule(ctx, id, time.Now().Add(-time.Millisecond))
+	if err != nil || !ok {
+		t.Fatalf("Reschedule = %v, %v", ok, err)
+	}
+	if ok, _ := q.Reschedule(ctx, "missing", time.Now()); ok {
+		t.Error("Expected Reschedule of missing id to report false")
+	}
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 1 || jobs[0].ID != id {
+		t.Fatalf("Expected rescheduled job to be due, got %+v", jobs)
+	}
+
+	id, _ = q.ScheduleAfter(ctx, []byte("b"), -time.Second)
+	if ok, err := q.Cancel(ctx, id); err != nil || !ok {
+		t.Fatalf("Cancel = %v, %v", ok, err)
+	}
+	if ok, _ := q.Cancel(ctx, id); ok {
+		t.Error("Expected second Cancel to report false")
+	}
+	if jobs, _ := q.Claim(ctx, 10); len(jobs) != 0 {
+		t.Errorf("Expected cancelled job not to be claimed, got %+v", jobs)
+	}
+}
+
+func TestDelayQueue_Run(t *testing.T) {
+	q := newTestDelayQueue(t, WithDelayQueuePollInterval(50*time.Millisecond), WithDelayQueueRetry(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []string
+	failed := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := q.Run(ctx, func(ctx context.Context, job *DelayedJob) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if string(job.Body) == "retry" && !failed {
+				failed = true
+				return errors.New("fail once")
+			}
+			got = append(got, string(job.Body))
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	}()
+
+	q.ScheduleAfter(context.Background(), []byte("a"), 100*time.Millisecond)
+	q.ScheduleAfter(context.Background(), []byte("retry"), 0)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || !failed {
+		t.Errorf("Expected both jobs processed after one retry, got %v", got)
+	}
+}
+
+func TestDelayQueue_RunWakesAtNextDue(t *testing.T) {
+	q := newTestDelayQueue(t, WithDelayQueuePollInterval(5*time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	due := time.Now().Add(200 * time.Millisecond)
+	q.Schedule(ctx, []byte("soon"), due)
+	if next, err := q.nextDue(ctx); err != nil || next.UnixMilli() != due.UnixMilli() {
+		t.Fatalf("Expected next due %v, got %v %v", due, next, err)
+	}
+
+	processed := make(chan time.Time, 1)
+	go q.Run(ctx, func(ctx context.Context, job *DelayedJob) error {
+		processed <- time.Now()
+		return nil
+	})
+	select {
+	case at := <-processed:
+		if at.Sub(due) > time.Second {
+			t.Errorf("Expected job processed near its due time, took %v", at.Sub(due))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Run to wake before poll interval")
+	}
+}
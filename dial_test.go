@@ -0,0 +1,127 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// refusedAddr 返回一个没有监听的本地地址
+func refusedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestConn_Errors(t *testing.T) {
+	s := newFakeServer(t, func(args []string) interface{} {
+		switch {
+		case args[0] == "AUTH" && args[1] != "secret":
+			return redis.Error("WRONGPASS invalid username-password pair")
+		case args[0] == "SELECT":
+			return redis.Error("ERR DB index is out of range")
+		}
+		return "OK"
+	})
+	tests := []struct {
+		name string
+		addr string
+		auth string
+		db   int
+		kind error
+	}{
+		{"dial", refusedAddr(t), "secret", 0, ErrDial},
+		{"auth", s.Addr(), "wrong", 0, ErrAuth},
+		{"select", s.Addr(), "secret", 1, ErrSelectDB},
+	}
+	for _, tt := range tests {
+		err := Conn(tt.addr, tt.auth, tt.db, WithRedisOption(redis.DialConnectTimeout(time.Second)))
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.kind, err)
+		}
+		var connErr *ConnError
+		if !errors.As(err, &connErr) || connErr.Addr != tt.addr {
+			t.Errorf("%s: expected *ConnError for %s, got %v", tt.name, tt.addr, err)
+		}
+	}
+}
+
+func TestConn_LazyConnect(t *testing.T) {
+	s := newFakeServer(t, func(args []string) interface{} {
+		if args[0] == "PING" {
+			return "PONG"
+		}
+		return "OK"
+	})
+	var calls int32
+	provider := func() (string, string, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return "", "", errors.New("secret not ready")
+		}
+		return "", "secret", nil
+	}
+	r := newRedisPool(WithLazyConnect(10*time.Millisecond), WithCredentialsProvider(provider))
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial(s.Addr(), "", 0)
+	})
+	if err := r.start(pool); err != nil {
+		t.Fatalf("Expected lazy connect without error, got %v", err)
+	}
+	t.Cleanup(func() { r.config.Tracker.Close(pool) })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := PingConn(context.Background(), func(ctx context.Context) (redis.Conn, error) {
+			return r.config.Tracker.Get(ctx, pool)
+		})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected connection after background retry, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&calls) < 3 {
+		t.Errorf("Expected provider retried, got %d calls", calls)
+	}
+}
+
+func TestConn_ReplaceClosesOldPool(t *testing.T) {
+	handler := func(args []string) interface{} {
+		if args[0] == "GET" {
+			return []byte("v")
+		}
+		return "OK"
+	}
+	s1, s2 := newFakeServer(t, handler), newFakeServer(t, handler)
+	t.Cleanup(func() { setGlobalPool(nil) })
+
+	if err := Conn(s1.Addr(), "secret", 0); err != nil {
+		t.Fatalf("Conn err: %v", err)
+	}
+	old := redisPool.Load()
+	if err := Conn(s2.Addr(), "secret", 0); err != nil {
+		t.Fatalf("Conn err: %v", err)
+	}
+	if v, err := redis.String(CommonCmd("GET", "k")); err != nil || v != "v" {
+		t.Errorf("Expected command on the new pool, got %q %v", v, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for old.redis_pool.Stats().ActiveCount != 0 || !old.config.Tracker.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected old pool closed, got %+v", old.redis_pool.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,14 @@
+package zredis
+
+import (
+	"testing"
+
+	"github.com/Xuzan9396/zredis/internal/redistest"
+)
+
+// fakeServer 测试用的RESP服务端，handler 根据命令参数返回回复
+type fakeServer = redistest.Server
+
+func newFakeServer(t *testing.T, handler func(args []string) interface{}) *fakeServer {
+	return redistest.NewServer(t, handler)
+}
@@ -2,4 +2,10 @@ module github.com/Xuzan9396/zredis
 
 go 1.20
 
-require github.com/garyburd/redigo v1.6.4
+require (
+	github.com/garyburd/redigo v1.6.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -0,0 +1,73 @@
+package zredis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Health 连接池的健康检查结果，可以直接序列化为 JSON 作为就绪探针的响应
+type Health struct {
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	Stats   PoolStats     `json:"stats"`
+}
+
+// PingConn 使用 getConn 获取连接执行 PING，遵守 ctx 的取消与截止时间
+func PingConn(ctx context.Context, getConn ConnGetter) error {
+	c, err := getConn(ctx)
+	if err != nil {
+		return err
+	}
+	reply, err := redis.String(DoContext(ctx, c, "PING"))
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("zredis: unexpected PING reply %q", reply)
+	}
+	return nil
+}
+
+// CheckHealth 执行 PING 并记录延迟，Stats 由调用方填充
+func CheckHealth(ctx context.Context, getConn ConnGetter) Health {
+	start := time.Now()
+	err := PingConn(ctx, getConn)
+	h := Health{Healthy: err == nil, Latency: time.Since(start)}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	return h
+}
+
+// Stats 返回全局连接池的统计，未初始化时返回零值
+func Stats() PoolStats {
+	r := redisPool.Load()
+	if r == nil {
+		return PoolStats{}
+	}
+	return r.config.Tracker.Stats(r.redis_pool)
+}
+
+// Ping 检查全局连接池能否执行命令，可用于就绪探针
+func Ping(ctx context.Context) error {
+	return PingConn(ctx, getConn)
+}
+
+// HealthCheck 执行 PING 并返回延迟和连接池统计
+//
+//	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+//		h := zredis.HealthCheck(r.Context())
+//		if !h.Healthy {
+//			w.WriteHeader(http.StatusServiceUnavailable)
+//		}
+//		json.NewEncoder(w).Encode(h)
+//	})
+func HealthCheck(ctx context.Context) Health {
+	h := CheckHealth(ctx, getConn)
+	h.Stats = Stats()
+	return h
+}
@@ -0,0 +1,143 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestConnTracker_Stats(t *testing.T) {
+	r := newTrackedTestPool(t, WithMaxActive(1))
+	stats := r.config.Tracker.Stats(r.redis_pool)
+	if stats.Dials != 1 || stats.ActiveCount != 1 || stats.IdleCount != 1 || stats.InUseCount != 0 {
+		t.Errorf("Unexpected stats after start %+v", stats)
+	}
+
+	c, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	if _, err := r.config.Tracker.Get(context.Background(), r.redis_pool); err != redis.ErrPoolExhausted {
+		t.Errorf("Expected ErrPoolExhausted, got %v", err)
+	}
+	if _, err := redis.DoWithTimeout(c, 50*time.Millisecond, "BRPOP", "test:stats:empty", 0); err == nil {
+		t.Error("Expected read timeout")
+	}
+	stats = r.config.Tracker.Stats(r.redis_pool)
+	if stats.InUseCount != 1 || stats.ExhaustedCount != 1 || stats.Timeouts != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	c.Close()
+	if stats = r.config.Tracker.Stats(r.redis_pool); stats.InUseCount != 0 {
+		t.Errorf("Expected connection returned, got %+v", stats)
+	}
+}
+
+func TestConnTracker_WaitStats(t *testing.T) {
+	r := newTrackedTestPool(t, WithMaxActive(1), WithWait(true))
+	c, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	inUse := make(chan int, 1)
+	time.AfterFunc(50*time.Millisecond, func() {
+		inUse <- r.config.Tracker.Stats(r.redis_pool).InUseCount
+		c.Close()
+	})
+	c2, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+	if err != nil {
+		t.Fatalf("Expected Get to wait for the returned connection, got %v", err)
+	}
+	c2.Close()
+	if n := <-inUse; n != 1 {
+		t.Errorf("Expected waiting caller not counted as in use, got %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	c, _ = r.config.Tracker.Get(context.Background(), r.redis_pool)
+	defer c.Close()
+	if _, err := r.config.Tracker.Get(ctx, r.redis_pool); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	stats := r.config.Tracker.Stats(r.redis_pool)
+	if stats.WaitCount != 2 || stats.WaitDuration < 50*time.Millisecond || stats.Timeouts != 1 || stats.ExhaustedCount != 0 {
+		t.Errorf("Unexpected wait stats %+v", stats)
+	}
+}
+
+func TestConnTracker_WaitStatsSlowDial(t *testing.T) {
+	s := newFakeServer(t, func(args []string) interface{} {
+		time.Sleep(20 * time.Millisecond)
+		return "OK"
+	})
+	r := newRedisPool(WithMaxActive(2), WithWait(true))
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial(s.Addr(), "secret", 0)
+	})
+	defer r.config.Tracker.Close(pool)
+
+	c1, err := r.config.Tracker.Get(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	defer c1.Close()
+	c2, err := r.config.Tracker.Get(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	defer c2.Close()
+	if stats := r.config.Tracker.Stats(pool); stats.WaitCount != 0 || stats.InUseCount != 2 || stats.Dials != 2 {
+		t.Errorf("Expected slow dials below MaxActive not counted as waits, got %+v", stats)
+	}
+}
+
+func TestConnTracker_ContextStats(t *testing.T) {
+	r := newTrackedTestPool(t)
+	getConn := func() redis.Conn {
+		c, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+		if err != nil {
+			t.Fatalf("Get err: %v", err)
+		}
+		return c
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := DoContext(ctx, getConn(), "BRPOP", "test:stats:empty", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+	if _, err := DoContext(ctx, getConn(), "PING"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+
+	stats := r.config.Tracker.Stats(r.redis_pool)
+	if stats.Timeouts != 2 || stats.WaitCount != 0 || stats.InUseCount != 0 {
+		t.Errorf("Unexpected context stats %+v", stats)
+	}
+}
+
+func TestConnTracker_DialErrors(t *testing.T) {
+	r := newRedisPool(WithLazyConnect(time.Hour))
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial("127.0.0.1:1", "", 0)
+	})
+	if err := r.start(pool); err != nil {
+		t.Fatalf("Expected lazy start, got %v", err)
+	}
+	defer r.config.Tracker.Close(pool)
+
+	h := CheckHealth(context.Background(), func(ctx context.Context) (redis.Conn, error) {
+		return r.config.Tracker.Get(ctx, pool)
+	})
+	if h.Healthy || h.Error == "" {
+		t.Errorf("Expected unhealthy, got %+v", h)
+	}
+	if stats := r.config.Tracker.Stats(pool); stats.Dials != 2 || stats.DialErrors != 2 {
+		t.Errorf("Expected 2 failed dials, got %+v", stats)
+	}
+}
@@ -0,0 +1,174 @@
+// Package redistest 提供测试用的 RESP 服务端，供各模式的测试模拟 Redis 的回复和错误
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Handler 根据命令参数返回回复，命令名已转为大写
+// 回复可以是 nil、redis.Error、string（状态回复）、[]byte、int、int64、[]string 和 []interface{}
+type Handler func(args []string) interface{}
+
+// Server 测试用的RESP服务端，handler 根据命令参数返回回复
+type Server struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	handler Handler
+	conns   []net.Conn
+	open    int
+}
+
+// NewServer 在随机端口启动服务端，测试结束时自动关闭
+func NewServer(t testing.TB, handler Handler) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &Server{ln: ln, handler: handler}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// HostPort 返回监听的主机和端口
+func (s *Server) HostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	return host, port
+}
+
+// SetHandler 替换 handler，之后收到的命令使用新的 handler
+func (s *Server) SetHandler(handler Handler) {
+	s.mu.Lock()
+	s.handler = handler
+	s.mu.Unlock()
+}
+
+// OpenConns 返回客户端还没有关闭的连接数
+func (s *Server) OpenConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.open++
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		s.open--
+		s.mu.Unlock()
+	}()
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		args[0] = strings.ToUpper(args[0])
+		s.mu.Lock()
+		handler := s.handler
+		s.mu.Unlock()
+		writeReply(w, handler(args))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case redis.Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unsupported reply %T\r\n", v)
+	}
+}
@@ -0,0 +1,220 @@
+package zredis
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 常用的键事件类型，对应 __keyevent@<db>__:<event> 频道
+const (
+	KeyEventExpired = "expired"
+	KeyEventEvicted = "evicted"
+	KeyEventDel     = "del"
+	KeyEventSet     = "set"
+	KeyEventExpire  = "expire"
+	KeyEventRename  = "rename_to"
+)
+
+// keyspaceAllFlags notify-keyspace-events 中 "A" 代表的事件类型
+const keyspaceAllFlags = "g$lshzxetd"
+
+// KeyEvent 键空间通知事件
+type KeyEvent struct {
+	DB int
+	// Event 事件类型，如 expired、evicted、del
+	Event string
+	Key   string
+	// Channel 收到通知的频道
+	Channel string
+}
+
+// KeyEventHandler 键空间通知处理函数，在监听器的协程中依次调用
+type KeyEventHandler func(event KeyEvent)
+
+type keyspaceOptions struct {
+	db         int
+	notify     string
+	subscriber []Subscriber_func
+}
+
+// Keyspace_func 键空间通知监听器的配置选项
+type Keyspace_func func(*keyspaceOptions)
+
+// WithKeyspaceDB 设置监听的数据库，默认使用 Conn 选择的数据库
+func WithKeyspaceDB(db int) Keyspace_func {
+	return func(o *keyspaceOptions) {
+		o.db = db
+	}
+}
+
+// WithKeyspaceNotify 启动时通过 CONFIG SET 开启 notify-keyspace-events，flags 会与服务端已有的配置合并
+// 例如 "Ex" 开启过期事件，"Eg" 开启 del 等通用事件；CONFIG 被禁用时只记录日志
+func WithKeyspaceNotify(flags string) Keyspace_func {
+	return func(o *keyspaceOptions) {
+		o.notify = flags
+	}
+}
+
+// WithKeyspaceSubscriber 设置底层订阅者的选项，如心跳间隔和重连间隔
+func WithKeyspaceSubscriber(opts ...Subscriber_func) Keyspace_func {
+	return func(o *keyspaceOptions) {
+		o.subscriber = append(o.subscriber, opts...)
+	}
+}
+
+// KeyspaceListener 键空间通知监听器，使用 Subscriber 的专用连接，断开后自动重连并重新订阅
+// 断开期间的通知会丢失，Redis 不会补发
+type KeyspaceListener struct {
+	commander RedisCommander
+	sub       *Subscriber
+	opts      keyspaceOptions
+
+	mu       sync.RWMutex
+	events   map[string][]KeyEventHandler
+	patterns map[string][]KeyEventHandler
+
+	done chan struct{}
+}
+
+// NewKeyspaceListener 创建基于全局连接池的键空间通知监听器
+func NewKeyspaceListener(opts ...Keyspace_func) *KeyspaceListener {
+	initGlobalCommander()
+	db := 0
+	if r := redisPool.Load(); r != nil {
+		db = r.db
+	}
+	return NewKeyspaceListenerWithConn(globalCommander, getConn, append([]Keyspace_func{WithKeyspaceDB(db)}, opts...)...)
+}
+
+// NewKeyspaceListenerWithConn 创建键空间通知监听器，commander 用于 CONFIG SET，getConn 用于订阅的专用连接
+func NewKeyspaceListenerWithConn(commander RedisCommander, getConn ConnGetter, opts ...Keyspace_func) *KeyspaceListener {
+	l := &KeyspaceListener{
+		commander: commander,
+		events:    make(map[string][]KeyEventHandler),
+		patterns:  make(map[string][]KeyEventHandler),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	if l.opts.notify != "" {
+		if err := EnableKeyspaceNotifications(commander, l.opts.notify); err != nil {
+			log.Printf("keyspace enable notify-keyspace-events err:%v", err)
+		}
+	}
+	l.sub = NewSubscriberWithConn(getConn, l.opts.subscriber...)
+	go l.dispatch()
+	return l
+}
+
+// EnableKeyspaceNotifications 把 flags 合并到服务端的 notify-keyspace-events 配置中
+func EnableKeyspaceNotifications(commander RedisCommander, flags string) error {
+	values, err := redis.Strings(commander.Cmd("CONFIG", "GET", "notify-keyspace-events"))
+	if err != nil {
+		return err
+	}
+	current := ""
+	if len(values) == 2 {
+		current = values[1]
+	}
+	merged := mergeKeyspaceFlags(current, flags)
+	if merged == current {
+		return nil
+	}
+	_, err = commander.Cmd("CONFIG", "SET", "notify-keyspace-events", merged)
+	return err
+}
+
+func mergeKeyspaceFlags(current, flags string) string {
+	merged := current
+	for _, f := range flags {
+		if strings.ContainsRune(merged, f) {
+			continue
+		}
+		if strings.ContainsRune(merged, 'A') && strings.ContainsRune(keyspaceAllFlags, f) {
+			continue
+		}
+		merged += string(f)
+	}
+	return merged
+}
+
+// On 订阅键事件，如 KeyEventExpired，handler 收到的 Key 为发生事件的 key
+func (l *KeyspaceListener) On(event string, handler KeyEventHandler) error {
+	channel := fmt.Sprintf("__keyevent@%d__:%s", l.opts.db, event)
+	l.mu.Lock()
+	l.events[channel] = append(l.events[channel], handler)
+	l.mu.Unlock()
+	return l.sub.Subscribe(channel)
+}
+
+// OnKey 订阅匹配 pattern 的 key 上发生的所有事件，需要开启 "K" 类通知
+func (l *KeyspaceListener) OnKey(pattern string, handler KeyEventHandler) error {
+	channel := fmt.Sprintf("__keyspace@%d__:%s", l.opts.db, pattern)
+	l.mu.Lock()
+	l.patterns[channel] = append(l.patterns[channel], handler)
+	l.mu.Unlock()
+	return l.sub.PSubscribe(channel)
+}
+
+// Close 停止监听，等待正在执行的处理函数返回
+func (l *KeyspaceListener) Close() error {
+	err := l.sub.Close()
+	<-l.done
+	return err
+}
+
+func (l *KeyspaceListener) dispatch() {
+	defer close(l.done)
+	for msg := range l.sub.Messages() {
+		event, ok := parseKeyEvent(msg)
+		if !ok {
+			continue
+		}
+		l.mu.RLock()
+		var handlers []KeyEventHandler
+		if msg.Pattern != "" {
+			handlers = l.patterns[msg.Pattern]
+		} else {
+			handlers = l.events[msg.Channel]
+		}
+		l.mu.RUnlock()
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// parseKeyEvent 解析 __keyevent@<db>__:<event>（内容为 key）和 __keyspace@<db>__:<key>（内容为事件）
+func parseKeyEvent(msg Message) (KeyEvent, bool) {
+	var kind string
+	switch {
+	case strings.HasPrefix(msg.Channel, "__keyevent@"):
+		kind = "keyevent"
+	case strings.HasPrefix(msg.Channel, "__keyspace@"):
+		kind = "keyspace"
+	default:
+		return KeyEvent{}, false
+	}
+	rest := msg.Channel[len("__"+kind+"@"):]
+	end := strings.Index(rest, "__:")
+	if end < 0 {
+		return KeyEvent{}, false
+	}
+	db, err := strconv.Atoi(rest[:end])
+	if err != nil {
+		return KeyEvent{}, false
+	}
+	event := KeyEvent{DB: db, Channel: msg.Channel}
+	if kind == "keyevent" {
+		event.Event, event.Key = rest[end+3:], string(msg.Payload)
+	} else {
+		event.Event, event.Key = string(msg.Payload), rest[end+3:]
+	}
+	return event, true
+}
@@ -0,0 +1,80 @@
+package zredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseKeyEvent(t *testing.T) {
+	tests := []struct {
+		msg  Message
+		want KeyEvent
+		ok   bool
+	}{
+		{Message{Channel: "__keyevent@0__:expired", Payload: []byte("session:1")}, KeyEvent{DB: 0, Event: "expired", Key: "session:1"}, true},
+		{Message{Channel: "__keyspace@3__:user:a:b", Pattern: "__keyspace@3__:user:*", Payload: []byte("del")}, KeyEvent{DB: 3, Event: "del", Key: "user:a:b"}, true},
+		{Message{Channel: "__keyevent@x__:expired"}, KeyEvent{}, false},
+		{Message{Channel: "orders"}, KeyEvent{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseKeyEvent(tt.msg)
+		tt.want.Channel = tt.msg.Channel
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseKeyEvent(%q) = %+v, %v, want %+v, %v", tt.msg.Channel, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMergeKeyspaceFlags(t *testing.T) {
+	tests := []struct{ current, flags, want string }{
+		{"", "Ex", "Ex"},
+		{"Kx", "Ex", "KxE"},
+		{"AKE", "Ex", "AKE"},
+		{"Eg", "Egx", "Egx"},
+	}
+	for _, tt := range tests {
+		if got := mergeKeyspaceFlags(tt.current, tt.flags); got != tt.want {
+			t.Errorf("mergeKeyspaceFlags(%q, %q) = %q, want %q", tt.current, tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestKeyspaceListener_On(t *testing.T) {
+	commander, getConn := newRedisTestCommander(t)
+	l := NewKeyspaceListenerWithConn(commander, getConn, WithKeyspaceDB(5))
+	defer l.Close()
+
+	events := make(chan KeyEvent, 10)
+	if err := l.On(KeyEventExpired, func(e KeyEvent) { events <- e }); err != nil {
+		t.Fatalf("On err: %v", err)
+	}
+	if err := l.OnKey("session:*", func(e KeyEvent) { events <- e }); err != nil {
+		t.Fatalf("OnKey err: %v", err)
+	}
+
+	// 通过发布模拟服务端的通知，不依赖服务端开启 notify-keyspace-events
+	publishUntil(t, commander, "__keyevent@5__:expired", "session:1")
+	publishUntil(t, commander, "__keyspace@5__:session:2", "evicted")
+	// 其他数据库的通知不会收到
+	commander.Publish("__keyevent@6__:expired", "session:3")
+
+	want := []KeyEvent{
+		{DB: 5, Event: KeyEventExpired, Key: "session:1", Channel: "__keyevent@5__:expired"},
+		{DB: 5, Event: KeyEventEvicted, Key: "session:2", Channel: "__keyspace@5__:session:2"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Errorf("Expected %+v, got %+v", w, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for %+v", w)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
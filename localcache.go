@@ -0,0 +1,512 @@
+package zredis
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// TrackingChannel RESP2 客户端缓存（CLIENT TRACKING）的失效通知频道
+const TrackingChannel = "__redis__:invalidate"
+
+// localWriteCommands 通过 Cmd 执行时需要让本地缓存失效的命令
+var localWriteCommands = map[string]bool{
+	"SET": true, "SETEX": true, "PSETEX": true, "SETNX": true, "GETSET": true, "GETDEL": true, "GETEX": true,
+	"DEL": true, "UNLINK": true, "EXPIRE": true, "PEXPIRE": true, "EXPIREAT": true, "PEXPIREAT": true, "PERSIST": true,
+	"INCR": true, "INCRBY": true, "INCRBYFLOAT": true, "DECR": true, "DECRBY": true,
+	"APPEND": true, "SETRANGE": true, "SETBIT": true, "RENAME": true, "RENAMENX": true,
+}
+
+// LocalCacheStats 本地缓存统计
+type LocalCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Size          int
+}
+
+type localCacheOptions struct {
+	maxSize      int
+	ttl          time.Duration
+	channel      string
+	tracking     bool
+	prefixes     []string
+	pingInterval time.Duration
+	retryBackoff time.Duration
+}
+
+// LocalCache_func 本地缓存的配置选项
+type LocalCache_func func(*localCacheOptions)
+
+// WithLocalCacheSize 设置本地缓存最多保存的 key 数量，默认 10000
+func WithLocalCacheSize(size int) LocalCache_func {
+	return func(o *localCacheOptions) {
+		o.maxSize = size
+	}
+}
+
+// WithLocalCacheTTL 设置本地缓存时间，默认 1 分钟
+func WithLocalCacheTTL(ttl time.Duration) LocalCache_func {
+	return func(o *localCacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithLocalCacheInvalidation 通过 pub/sub 频道在多个实例间广播失效消息，写命令会发布被修改的 key
+func WithLocalCacheInvalidation(channel string) LocalCache_func {
+	return func(o *localCacheOptions) {
+		o.channel = channel
+	}
+}
+
+// WithLocalCacheTracking 使用 CLIENT TRACKING BCAST 模式由 Redis 推送失效消息，需要 Redis 6.0+
+// prefixes 为空时跟踪所有 key
+func WithLocalCacheTracking(prefixes ...string) LocalCache_func {
+	return func(o *localCacheOptions) {
+		o.tracking = true
+		o.prefixes = prefixes
+	}
+}
+
+// WithLocalCachePingInterval 设置订阅连接的心跳间隔，默认 30 秒，超过两个间隔没有回复视为连接断开
+func WithLocalCachePingInterval(interval time.Duration) LocalCache_func {
+	return func(o *localCacheOptions) {
+		o.pingInterval = interval
+	}
+}
+
+type localEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// LocalCache 进程内 LRU 缓存，包装 RedisCommander 作为二级缓存
+// Get 优先读取本地缓存，写命令会让本地缓存失效，开启失效通知后其他实例的修改也会同步失效
+type LocalCache struct {
+	RedisCommander
+
+	opts    localCacheOptions
+	getConn ConnGetter
+
+	mu      sync.Mutex
+	ll      *list.List
+	items   map[string]*list.Element
+	version uint64
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewLocalCache 创建基于全局连接池的本地缓存
+func NewLocalCache(opts ...LocalCache_func) *LocalCache {
+	initGlobalCommander()
+	return NewLocalCacheWithConn(globalCommander, getConn, opts...)
+}
+
+// NewLocalCacheWithConn 创建包装 commander 的本地缓存，getConn 用于获取订阅失效消息的专用连接
+// 没有开启失效通知时 getConn 可以为 nil
+func NewLocalCacheWithConn(commander RedisCommander, getConn ConnGetter, opts ...LocalCache_func) *LocalCache {
+	l := &LocalCache{
+		RedisCommander: commander,
+		opts: localCacheOptions{
+			maxSize:      10000,
+			ttl:          time.Minute,
+			pingInterval: 30 * time.Second,
+			retryBackoff: time.Second,
+		},
+		getConn: getConn,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+
+	if getConn != nil && (l.opts.channel != "" || l.opts.tracking) {
+		ctx, cancel := context.WithCancel(context.Background())
+		l.cancel = cancel
+		go l.run(ctx)
+	} else {
+		close(l.done)
+	}
+	return l
+}
+
+// Get 优先从本地缓存读取，未命中时读取 Redis 并写入本地缓存，key 不存在时不缓存
+func (l *LocalCache) Get(key string) (interface{}, error) {
+	if value, ok := l.load(key); ok {
+		return value, nil
+	}
+	version := l.currentVersion()
+	reply, err := l.RedisCommander.Get(key)
+	if value, ok := reply.([]byte); ok && err == nil {
+		l.store(key, value, version)
+	}
+	return reply, err
+}
+
+func (l *LocalCache) Cmd(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	cmd := strings.ToUpper(cmdStr)
+	if cmd == "GET" && len(keysAndArgs) == 1 {
+		if key, ok := keysAndArgs[0].(string); ok {
+			return l.Get(key)
+		}
+	}
+	reply, err := l.RedisCommander.Cmd(cmdStr, keysAndArgs...)
+	if localWriteCommands[cmd] && len(keysAndArgs) > 0 {
+		keys := keysAndArgs[:1]
+		if cmd == "DEL" || cmd == "UNLINK" || cmd == "RENAME" || cmd == "RENAMENX" {
+			keys = keysAndArgs
+		}
+		for _, key := range keys {
+			if key, ok := key.(string); ok {
+				l.invalidateAndPublish(key)
+			}
+		}
+	}
+	return reply, err
+}
+
+func (l *LocalCache) Set(key string, val interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.Set(key, val)
+}
+
+func (l *LocalCache) SetEx(key string, val interface{}, timeExpire int64) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.SetEx(key, val, timeExpire)
+}
+
+func (l *LocalCache) SetNx(key string, val interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.SetNx(key, val)
+}
+
+func (l *LocalCache) SetNxEx(key string, val interface{}, timeExpire int) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.SetNxEx(key, val, timeExpire)
+}
+
+func (l *LocalCache) Del(key string) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.Del(key)
+}
+
+func (l *LocalCache) Expire(key string, timeInt int) error {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.Expire(key, timeInt)
+}
+
+func (l *LocalCache) ExpireAt(key string, timestampInt int64) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.ExpireAt(key, timestampInt)
+}
+
+func (l *LocalCache) IncrBy(key string) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.IncrBy(key)
+}
+
+func (l *LocalCache) IncrbyVal(key string, val interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.IncrbyVal(key, val)
+}
+
+func (l *LocalCache) IncrbyFloat(key string, val interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.IncrbyFloat(key, val)
+}
+
+func (l *LocalCache) DecrByNum(key string, num interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.DecrByNum(key, num)
+}
+
+func (l *LocalCache) SetBit(key string, offset, val interface{}) (interface{}, error) {
+	defer l.invalidateAndPublish(key)
+	return l.RedisCommander.SetBit(key, offset, val)
+}
+
+// DelPattern 删除匹配的 key 并清空本地缓存
+func (l *LocalCache) DelPattern(patternKey string) error {
+	defer l.invalidateAndPublish("")
+	return l.RedisCommander.DelPattern(patternKey)
+}
+
+// Codec 返回被包装命令实例的编解码器
+func (l *LocalCache) Codec() Codec {
+	return codecOf(l.RedisCommander)
+}
+
+// Context 返回被包装命令实例绑定的context
+func (l *LocalCache) Context() context.Context {
+	return commanderContext(l.RedisCommander)
+}
+
+// Invalidate 让本地缓存中的 key 失效，不广播
+func (l *LocalCache) Invalidate(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version++
+	for _, key := range keys {
+		if e, ok := l.items[key]; ok {
+			l.removeElement(e)
+			atomic.AddUint64(&l.invalidations, 1)
+		}
+	}
+}
+
+// Flush 清空本地缓存，不广播
+func (l *LocalCache) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version++
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+// Stats 返回本地缓存的命中统计
+func (l *LocalCache) Stats() LocalCacheStats {
+	l.mu.Lock()
+	size := l.ll.Len()
+	l.mu.Unlock()
+	return LocalCacheStats{
+		Hits:          atomic.LoadUint64(&l.hits),
+		Misses:        atomic.LoadUint64(&l.misses),
+		Evictions:     atomic.LoadUint64(&l.evictions),
+		Invalidations: atomic.LoadUint64(&l.invalidations),
+		Size:          size,
+	}
+}
+
+// Close 停止订阅失效消息
+func (l *LocalCache) Close() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+	<-l.done
+}
+
+func (l *LocalCache) load(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.items[key]; ok {
+		entry := e.Value.(*localEntry)
+		if time.Now().Before(entry.expireAt) {
+			l.ll.MoveToFront(e)
+			atomic.AddUint64(&l.hits, 1)
+			return entry.value, true
+		}
+		l.removeElement(e)
+	}
+	atomic.AddUint64(&l.misses, 1)
+	return nil, false
+}
+
+func (l *LocalCache) currentVersion() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.version
+}
+
+// store 写入本地缓存，读取期间发生过失效时放弃写入，避免缓存旧值
+func (l *LocalCache) store(key string, value []byte, version uint64) {
+	if l.opts.maxSize <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.version != version {
+		return
+	}
+	entry := &localEntry{key: key, value: value, expireAt: time.Now().Add(l.opts.ttl)}
+	if e, ok := l.items[key]; ok {
+		e.Value = entry
+		l.ll.MoveToFront(e)
+		return
+	}
+	l.items[key] = l.ll.PushFront(entry)
+	for l.ll.Len() > l.opts.maxSize {
+		l.removeElement(l.ll.Back())
+		atomic.AddUint64(&l.evictions, 1)
+	}
+}
+
+func (l *LocalCache) removeElement(e *list.Element) {
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*localEntry).key)
+}
+
+// invalidateAndPublish 本地失效并通过 pub/sub 通知其他实例，key 为空时清空所有实例的本地缓存
+func (l *LocalCache) invalidateAndPublish(key string) {
+	if key == "" {
+		l.Flush()
+	} else {
+		l.Invalidate(key)
+	}
+	if l.opts.channel != "" && !l.opts.tracking {
+		if _, err := l.RedisCommander.Cmd("PUBLISH", l.opts.channel, key); err != nil {
+			log.Printf("local cache publish invalidation err:%v", err)
+		}
+	}
+}
+
+// run 订阅失效消息，连接断开后清空本地缓存并重新订阅
+func (l *LocalCache) run(ctx context.Context) {
+	defer close(l.done)
+	for {
+		err := l.listen(ctx)
+		// 断开期间可能错过失效消息
+		l.Flush()
+		// 连接池关闭后不再重连
+		if ctx.Err() != nil || errors.Is(err, ErrPoolClosed) {
+			return
+		}
+		log.Printf("local cache invalidation subscription err:%v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.opts.retryBackoff):
+		}
+	}
+}
+
+func (l *LocalCache) listen(ctx context.Context) error {
+	c, err := l.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	dedicateConn(c)
+
+	channel := l.opts.channel
+	if l.opts.tracking {
+		channel = TrackingChannel
+		tc, err := l.enableTracking(ctx, c)
+		if err != nil {
+			return err
+		}
+		defer disableTracking(tc)
+	}
+
+	if err := c.Send("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	// 退出前等待心跳协程结束，避免与连接关闭并发写
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(l.opts.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// 退订后 Receive 收到 unsubscribe 回复并返回
+				c.Send("UNSUBSCRIBE")
+				c.Flush()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.Send("PING")
+				c.Flush()
+			}
+		}
+	}()
+
+	for {
+		reply, err := redis.Values(redis.ReceiveWithTimeout(c, 2*l.opts.pingInterval))
+		if err != nil {
+			return err
+		}
+		if len(reply) < 2 {
+			continue
+		}
+		kind, _ := redis.String(reply[0], nil)
+		switch kind {
+		case "subscribe":
+			l.Flush()
+		case "unsubscribe":
+			if count, _ := redis.Int(reply[len(reply)-1], nil); count == 0 {
+				return ctx.Err()
+			}
+		case "message":
+			if len(reply) >= 3 {
+				l.handleInvalidation(reply[2])
+			}
+		}
+	}
+}
+
+// enableTracking 在另一条连接上开启 CLIENT TRACKING，把失效消息重定向到订阅连接
+func (l *LocalCache) enableTracking(ctx context.Context, c redis.Conn) (redis.Conn, error) {
+	id, err := redis.Int64(c.Do("CLIENT", "ID"))
+	if err != nil {
+		return nil, err
+	}
+	tc, err := l.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := []interface{}{"TRACKING", "on", "REDIRECT", id, "BCAST"}
+	for _, prefix := range l.opts.prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	dedicateConn(tc)
+	if _, err := tc.Do("CLIENT", args...); err != nil {
+		tc.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// disableTracking 关闭 CLIENT TRACKING 并丢弃连接，开启过跟踪的连接不再放回连接池，避免被其他调用复用
+func disableTracking(tc redis.Conn) {
+	tc.Do("CLIENT", "TRACKING", "off")
+	if a, ok := tc.(connAborter); ok {
+		a.abort()
+	}
+	tc.Close()
+}
+
+// handleInvalidation 处理失效消息，pub/sub 消息为单个 key，CLIENT TRACKING 消息为 key 数组，空值表示清空
+func (l *LocalCache) handleInvalidation(data interface{}) {
+	switch data := data.(type) {
+	case []byte:
+		if len(data) == 0 {
+			l.Flush()
+			return
+		}
+		l.Invalidate(string(data))
+	case []interface{}:
+		keys, _ := redis.Strings(data, nil)
+		l.Invalidate(keys...)
+	default:
+		l.Flush()
+	}
+}
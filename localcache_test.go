@@ -0,0 +1,190 @@
+package zredis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestLocalCache_HitMiss(t *testing.T) {
+	store, commander := newMemCommander()
+	store.set("local:a", []byte("1"))
+	cache := NewLocalCacheWithConn(commander, nil)
+	defer cache.Close()
+
+	for i := 0; i < 3; i++ {
+		v, err := redis.String(cache.Get("local:a"))
+		if err != nil || v != "1" {
+			t.Fatalf("Expected 1, got %v %v", v, err)
+		}
+	}
+	// 未命中 Redis 的 key 不缓存
+	cache.Get("local:missing")
+	cache.Get("local:missing")
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Size != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// 本地命中时不访问 Redis
+	store.set("local:a", []byte("2"))
+	if v, _ := redis.String(cache.Get("local:a")); v != "1" {
+		t.Errorf("Expected cached 1, got %v", v)
+	}
+	// 写命令让本地缓存失效
+	cache.Set("local:a", "3")
+	if v, _ := redis.String(cache.Get("local:a")); v != "3" {
+		t.Errorf("Expected 3 after Set, got %v", v)
+	}
+	cache.Cmd("SET", "local:a", "4")
+	if v, _ := redis.String(cache.Cmd("GET", "local:a")); v != "4" {
+		t.Errorf("Expected 4 after Cmd SET, got %v", v)
+	}
+}
+
+func TestLocalCache_EvictionAndTTL(t *testing.T) {
+	store, commander := newMemCommander()
+	for _, key := range []string{"a", "b", "c"} {
+		store.set(key, []byte(key))
+	}
+	cache := NewLocalCacheWithConn(commander, nil, WithLocalCacheSize(2), WithLocalCacheTTL(50*time.Millisecond))
+	defer cache.Close()
+
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("a")
+	cache.Get("c") // 淘汰最久未使用的 b
+	stats := cache.Stats()
+	if stats.Size != 2 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if _, ok := cache.load("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := cache.load("a"); !ok {
+		t.Error("Expected a to be cached")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.load("a"); ok {
+		t.Error("Expected a to expire")
+	}
+}
+
+func TestLocalCache_HandleInvalidation(t *testing.T) {
+	store, commander := newMemCommander()
+	for _, key := range []string{"a", "b", "c"} {
+		store.set(key, []byte(key))
+	}
+	cache := NewLocalCacheWithConn(commander, nil)
+	defer cache.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Get(key)
+	}
+
+	cache.handleInvalidation([]byte("a"))
+	cache.handleInvalidation([]interface{}{[]byte("b")})
+	if cache.Stats().Size != 1 {
+		t.Errorf("Expected only c cached, got %+v", cache.Stats())
+	}
+	cache.handleInvalidation(nil)
+	if cache.Stats().Size != 0 {
+		t.Errorf("Expected flush, got %+v", cache.Stats())
+	}
+}
+
+// newRedisTestCommander 连接本地 Redis 的命令实例，Redis 不可用时跳过测试
+func newRedisTestCommander(t *testing.T, opts ...redis.DialOption) (RedisCommanderCtx, ConnGetter) {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", "127.0.0.1:6379", append([]redis.DialOption{redis.DialPassword("27252725")}, opts...)...)
+		},
+	}
+	t.Cleanup(func() { pool.Close() })
+	getConn := func(ctx context.Context) (redis.Conn, error) {
+		return pool.GetContext(ctx)
+	}
+	commander := NewRedisCommandsCtx(func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+		c, err := getConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return DoContext(ctx, c, cmdStr, keysAndArgs...)
+	}, func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+		c, err := getConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lua := CachedScript(script)
+		return RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+			return lua.Do(c, []string{key}, args...)
+		})
+	})
+	if _, err := commander.Cmd("PING"); err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+	return commander, getConn
+}
+
+func TestLocalCache_PubSubInvalidation(t *testing.T) {
+	commander, getConn := newRedisTestCommander(t)
+	commander.Set("local:pubsub", "v1")
+
+	opts := []LocalCache_func{WithLocalCacheInvalidation("local:invalidate"), WithLocalCachePingInterval(100 * time.Millisecond)}
+	a := NewLocalCacheWithConn(commander, getConn, opts...)
+	defer a.Close()
+	b := NewLocalCacheWithConn(commander, getConn, opts...)
+	defer b.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	if v, _ := redis.String(b.Get("local:pubsub")); v != "v1" {
+		t.Fatalf("Expected v1, got %v", v)
+	}
+	a.Set("local:pubsub", "v2")
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if v, _ := redis.String(b.Get("local:pubsub")); v == "v2" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected invalidation message to reach the other instance")
+}
+
+func TestLocalCache_DisableTracking(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	s := newFakeServer(t, func(args []string) interface{} {
+		mu.Lock()
+		cmds = append(cmds, strings.Join(args, " "))
+		mu.Unlock()
+		return "OK"
+	})
+	r := newRedisPool()
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial(s.Addr(), "", 0)
+	})
+	defer r.config.Tracker.Close(pool)
+
+	c, err := r.config.Tracker.Get(context.Background(), pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	disableTracking(c)
+	mu.Lock()
+	got := strings.Join(cmds, ",")
+	mu.Unlock()
+	if got != "CLIENT TRACKING off" {
+		t.Errorf("Expected CLIENT TRACKING off, got %v", got)
+	}
+	// 开启过跟踪的连接不能回到连接池
+	if stats := pool.Stats(); stats.ActiveCount != 0 || stats.IdleCount != 0 {
+		t.Errorf("Expected tracking conn discarded, got %+v", stats)
+	}
+}
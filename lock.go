@@ -0,0 +1,284 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// ErrLockNotObtained 锁已被其他持有者占用
+	ErrLockNotObtained = errors.New("zredis: lock not obtained")
+	// ErrLockNotHeld 锁已过期或被其他持有者获取
+	ErrLockNotHeld = errors.New("zredis: lock not held")
+)
+
+// 只释放自己持有的锁
+const lockReleaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// 只续期自己持有的锁
+const lockExtendScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+type lockOptions struct {
+	ttl      time.Duration
+	retryMin time.Duration
+	retryMax time.Duration
+	watchdog bool
+	token    string
+
+	driftFactor float64
+	nodeTimeout time.Duration
+}
+
+// Lock_func 分布式锁的配置选项
+type Lock_func func(*lockOptions)
+
+// WithLockTTL 设置锁的过期时间，默认 30 秒
+func WithLockTTL(ttl time.Duration) Lock_func {
+	return func(o *lockOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithLockRetry 设置阻塞获取锁时的重试间隔，从 min 开始指数退避到 max，默认 10ms 到 500ms
+func WithLockRetry(min, max time.Duration) Lock_func {
+	return func(o *lockOptions) {
+		o.retryMin = min
+		o.retryMax = max
+	}
+}
+
+// WithLockWatchdog 持有锁期间每 ttl/3 自动续期，直到 Release
+func WithLockWatchdog() Lock_func {
+	return func(o *lockOptions) {
+		o.watchdog = true
+	}
+}
+
+// WithLockToken 使用指定的令牌，默认随机生成
+func WithLockToken(token string) Lock_func {
+	return func(o *lockOptions) {
+		o.token = token
+	}
+}
+
+// WithLockDriftFactor 设置 Redlock 的时钟漂移系数，有效期会扣除 ttl*factor+2ms，默认 0.01
+func WithLockDriftFactor(factor float64) Lock_func {
+	return func(o *lockOptions) {
+		o.driftFactor = factor
+	}
+}
+
+// WithLockNodeTimeout 设置 Redlock 访问单个节点的超时时间，默认 ttl/10，避免在故障节点上耗尽有效期
+func WithLockNodeTimeout(timeout time.Duration) Lock_func {
+	return func(o *lockOptions) {
+		o.nodeTimeout = timeout
+	}
+}
+
+func newLockOptions(opts ...Lock_func) lockOptions {
+	o := lockOptions{
+		ttl:      30 * time.Second,
+		retryMin: 10 * time.Millisecond,
+		retryMax: 500 * time.Millisecond,
+
+		driftFactor: 0.01,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.nodeTimeout <= 0 {
+		o.nodeTimeout = o.ttl / 10
+	}
+	return o
+}
+
+// Locker 基于 SET NX PX 的分布式锁，每次加锁使用随机令牌，只有持有者可以释放和续期
+type Locker struct {
+	commander RedisCommander
+	opts      []Lock_func
+}
+
+// NewLocker 创建基于全局连接池的分布式锁
+func NewLocker(opts ...Lock_func) *Locker {
+	initGlobalCommander()
+	return NewLockerWithCommander(globalCommander, opts...)
+}
+
+// NewLockerWithCommander 使用指定的命令实例创建分布式锁，opts 为默认选项，加锁时可以覆盖
+func NewLockerWithCommander(commander RedisCommander, opts ...Lock_func) *Locker {
+	return &Locker{commander: commander, opts: opts}
+}
+
+// TryLock 尝试获取一次锁，已被占用时返回 ErrLockNotObtained
+func (l *Locker) TryLock(ctx context.Context, key string, opts ...Lock_func) (*Lock, error) {
+	o := newLockOptions(append(l.opts[:len(l.opts):len(l.opts)], opts...)...)
+	return l.tryLock(ctx, key, o)
+}
+
+// Lock 阻塞获取锁，按指数退避重试直到成功或 ctx 结束
+func (l *Locker) Lock(ctx context.Context, key string, opts ...Lock_func) (*Lock, error) {
+	o := newLockOptions(append(l.opts[:len(l.opts):len(l.opts)], opts...)...)
+	return retryLock(ctx, o, func() (*Lock, error) {
+		return l.tryLock(ctx, key, o)
+	})
+}
+
+// retryLock 按指数退避重试 try，直到成功、返回其他错误或 ctx 结束
+func retryLock[T any](ctx context.Context, o lockOptions, try func() (T, error)) (T, error) {
+	backoff := o.retryMin
+	for {
+		lock, err := try()
+		if err != ErrLockNotObtained {
+			return lock, err
+		}
+		// 随机抖动，避免多个等待者同时重试
+		wait := backoff/2 + time.Duration(mrand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > o.retryMax {
+			backoff = o.retryMax
+		}
+	}
+}
+
+func (l *Locker) tryLock(ctx context.Context, key string, o lockOptions) (*Lock, error) {
+	token := o.token
+	if token == "" {
+		token = randomToken()
+	}
+	reply, err := commanderWithContext(l.commander, ctx).Cmd("SET", key, token, "NX", "PX", durationMs(o.ttl))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrLockNotObtained
+	}
+	lock := &Lock{
+		commander: l.commander,
+		key:       key,
+		token:     token,
+		ttl:       o.ttl,
+		lost:      make(chan struct{}),
+	}
+	if o.watchdog {
+		lock.startWatchdog()
+	}
+	return lock, nil
+}
+
+// Lock 已获取的锁
+type Lock struct {
+	commander RedisCommander
+	key       string
+	token     string
+	ttl       time.Duration
+
+	mu       sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// Key 返回锁的 key
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Token 返回锁的令牌
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Lost 开启自动续期后，续期失败（锁已丢失）时关闭该通道
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Extend 把锁的过期时间重置为 ttl，锁已不属于当前持有者时返回 ErrLockNotHeld
+func (lk *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	n, err := redis.Int(commanderWithContext(lk.commander, ctx).LuaScript(lockExtendScript, lk.key, lk.token, durationMs(ttl)))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release 停止自动续期并释放锁，锁已不属于当前持有者时返回 ErrLockNotHeld
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.stopWatchdog()
+	n, err := redis.Int(commanderWithContext(lk.commander, ctx).LuaScript(lockReleaseScript, lk.key, lk.token))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// startWatchdog 每 ttl/3 续期一次，连续失败超过 ttl 或锁已被他人持有时视为丢失
+func (lk *Lock) startWatchdog() {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	lk.stop = make(chan struct{})
+	lk.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		interval := lk.ttl / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := lk.Extend(ctx, lk.ttl)
+			cancel()
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			if err == ErrLockNotHeld || time.Since(renewed) >= lk.ttl {
+				lk.lostOnce.Do(func() { close(lk.lost) })
+				return
+			}
+		}
+	}(lk.stop, lk.done)
+}
+
+func (lk *Lock) stopWatchdog() {
+	lk.mu.Lock()
+	stop, done := lk.stop, lk.done
+	lk.stop, lk.done = nil, nil
+	lk.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
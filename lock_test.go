@@ -0,0 +1,102 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocker_TryLockRelease(t *testing.T) {
+	store, commander := newMemCommander()
+	locker := NewLockerWithCommander(commander)
+	ctx := context.Background()
+
+	lock, err := locker.TryLock(ctx, "lock:a")
+	if err != nil {
+		t.Fatalf("TryLock err: %v", err)
+	}
+	if raw, _ := store.get("lock:a"); string(raw) != lock.Token() || lock.Key() != "lock:a" {
+		t.Errorf("Expected token %s stored, got %s", lock.Token(), raw)
+	}
+	if _, err := locker.TryLock(ctx, "lock:a"); !errors.Is(err, ErrLockNotObtained) {
+		t.Errorf("Expected ErrLockNotObtained, got %v", err)
+	}
+	if err := lock.Extend(ctx, time.Minute); err != nil {
+		t.Errorf("Extend err: %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Release err: %v", err)
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Expected ErrLockNotHeld, got %v", err)
+	}
+}
+
+func TestLocker_ReleaseOthersLock(t *testing.T) {
+	store, commander := newMemCommander()
+	locker := NewLockerWithCommander(commander)
+	ctx := context.Background()
+
+	lock, _ := locker.TryLock(ctx, "lock:b")
+	// 锁过期后被其他持有者获取
+	store.set("lock:b", []byte("other"))
+	if err := lock.Extend(ctx, time.Minute); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Expected ErrLockNotHeld, got %v", err)
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Expected ErrLockNotHeld, got %v", err)
+	}
+	if raw, _ := store.get("lock:b"); string(raw) != "other" {
+		t.Errorf("Expected other's lock to remain, got %s", raw)
+	}
+}
+
+func TestLocker_LockBlocking(t *testing.T) {
+	store, commander := newMemCommander()
+	locker := NewLockerWithCommander(commander, WithLockRetry(5*time.Millisecond, 20*time.Millisecond))
+	store.set("lock:c", []byte("other"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "lock:c"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		store.execute("DEL", "lock:c")
+	}()
+	lock, err := locker.Lock(context.Background(), "lock:c", WithLockToken("mine"))
+	if err != nil || lock.Token() != "mine" {
+		t.Fatalf("Expected lock with token mine, got %v %v", lock, err)
+	}
+}
+
+func TestLocker_Watchdog(t *testing.T) {
+	commander, _ := newRedisTestCommander(t)
+	locker := NewLockerWithCommander(commander, WithLockTTL(150*time.Millisecond), WithLockWatchdog())
+	ctx := context.Background()
+	commander.Del("lock:watchdog")
+
+	lock, err := locker.TryLock(ctx, "lock:watchdog")
+	if err != nil {
+		t.Fatalf("TryLock err: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if _, err := locker.TryLock(ctx, "lock:watchdog"); !errors.Is(err, ErrLockNotObtained) {
+		t.Errorf("Expected lock to be renewed by watchdog, got %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Release err: %v", err)
+	}
+
+	lock, _ = locker.TryLock(ctx, "lock:watchdog")
+	commander.Set("lock:watchdog", "other")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Error("Expected Lost to be closed after the lock was taken over")
+	}
+	commander.Del("lock:watchdog")
+}
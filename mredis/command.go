@@ -1,19 +1,90 @@
 package mredis
 
 import (
+	"context"
 	"github.com/Xuzan9396/zredis"
+	"github.com/garyburd/redigo/redis"
+	"time"
 )
 
 // 获取指定名称的Redis命令实例
 func GetCommander(name string) zredis.RedisCommander {
-	return zredis.NewRedisCommands(
-		func(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
-			return CommonCmd(name, cmdStr, keysAndArgs...)
+	return GetCommanderCtx(context.Background(), name)
+}
+
+// GetCommanderCtx 获取指定名称、绑定了ctx的Redis命令实例
+func GetCommanderCtx(ctx context.Context, name string) zredis.RedisCommanderCtx {
+	return zredis.NewRedisCommandsCtx(
+		func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+			return CommonCmdCtx(ctx, name, cmdStr, keysAndArgs...)
 		},
-		func(script string, key string, args ...interface{}) (interface{}, error) {
-			return CommonLuaScript(name, script, key, args...)
+		func(ctx context.Context, script string, key string, args ...interface{}) (interface{}, error) {
+			return CommonLuaScriptCtx(ctx, name, script, key, args...)
 		},
-	)
+		zredis.WithCommandsCodec(getCodec(name)),
+	).WithContext(ctx)
+}
+
+// NewPipeline 创建基于指定名称连接池的管道
+func NewPipeline(name string) *zredis.Pipeline {
+	return zredis.NewPipelineWithConn(connGetter(name))
+}
+
+// TxPipelined 基于指定名称的连接池执行 MULTI/EXEC 事务
+func TxPipelined(ctx context.Context, name string, fn zredis.TxFunc, opts ...zredis.Tx_func) ([]zredis.PipelineResult, error) {
+	return zredis.TxPipelinedWithConn(ctx, connGetter(name), fn, opts...)
+}
+
+// NewLocalCache 创建基于指定名称连接池的本地缓存，失效通知使用连接池中的专用连接
+func NewLocalCache(name string, opts ...zredis.LocalCache_func) *zredis.LocalCache {
+	return zredis.NewLocalCacheWithConn(GetCommander(name), connGetter(name), opts...)
+}
+
+// NewLocker 创建基于指定名称连接池的分布式锁
+func NewLocker(name string, opts ...zredis.Lock_func) *zredis.Locker {
+	return zredis.NewLockerWithCommander(GetCommander(name), opts...)
+}
+
+// NewRedlock 在多个指定名称的连接池上创建 Redlock，各连接池应指向相互独立的 Redis 节点
+func NewRedlock(names []string, opts ...zredis.Lock_func) *zredis.Redlock {
+	nodes := make([]zredis.RedisCommander, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, GetCommander(name))
+	}
+	return zredis.NewRedlock(nodes, opts...)
+}
+
+// NewQueue 创建基于指定名称连接池的可靠队列
+func NewQueue(name, queueName string, opts ...zredis.Queue_func) *zredis.Queue {
+	return zredis.NewQueueWithCommander(GetCommander(name), queueName, opts...)
+}
+
+// NewDelayQueue 创建基于指定名称连接池的延迟队列
+func NewDelayQueue(name, queueName string, opts ...zredis.DelayQueue_func) *zredis.DelayQueue {
+	return zredis.NewDelayQueueWithCommander(GetCommander(name), queueName, opts...)
+}
+
+// NewStreamWorker 创建基于指定名称连接池的消费组 worker
+func NewStreamWorker(name, stream, group, consumer string, opts ...zredis.StreamWorker_func) *zredis.StreamWorker {
+	return zredis.NewStreamWorkerWithCommander(GetCommander(name), stream, group, consumer, opts...)
+}
+
+// NewSubscriber 创建使用指定名称连接池专用连接的订阅者
+func NewSubscriber(name string, opts ...zredis.Subscriber_func) *zredis.Subscriber {
+	return zredis.NewSubscriberWithConn(connGetter(name), opts...)
+}
+
+// NewKeyspaceListener 创建基于指定名称连接池的键空间通知监听器，默认监听 Conn 选择的数据库
+func NewKeyspaceListener(name string, opts ...zredis.Keyspace_func) *zredis.KeyspaceListener {
+	opts = append([]zredis.Keyspace_func{zredis.WithKeyspaceDB(getDB(name))}, opts...)
+	return zredis.NewKeyspaceListenerWithConn(GetCommander(name), connGetter(name), opts...)
+}
+
+// connGetter 返回指定名称连接池的连接获取函数
+func connGetter(name string) zredis.ConnGetter {
+	return func(ctx context.Context) (redis.Conn, error) {
+		return getConn(ctx, name)
+	}
 }
 
 // -------------------------  公众函数  -----------------------
@@ -119,6 +190,11 @@ func CommonBitCount(name, key string) (interface{}, error) {
 	return GetCommander(name).BitCount(key)
 }
 
+// CommonPublish 发布消息，返回收到消息的订阅者数量
+func CommonPublish(name, channel string, message interface{}) (int64, error) {
+	return GetCommander(name).Publish(channel, message)
+}
+
 func CommonDel(name, key string) (interface{}, error) {
 	return GetCommander(name).Del(key)
 }
@@ -202,9 +278,29 @@ func CallBackMsgpackCache(name, redisKey string, funcs zredis.FuncType, opt ...i
 	if len(opt) > 0 {
 		timeOut = opt[0]
 	}
-	return zredis.CallBackMsgpackCacheWithCommander(GetCommander(name), redisKey, funcs, timeOut)
+	return CallBackCache(name, redisKey, funcs, zredis.WithCacheTTL(time.Duration(timeOut)*time.Second))
 }
 
 func CallBackMsgpackCacheIn(name, redisKey string, funcs zredis.FuncTypeInt) ([]byte, error) {
-	return zredis.CallBackMsgpackCacheInWithCommander(GetCommander(name), redisKey, funcs)
+	return CallBackCacheIn(name, redisKey, funcs)
+}
+
+// CallBackCache 带缓存的回调函数，同一连接池内相同 key 的回源会合并为一次，支持重建锁、旧值兜底和概率提前过期
+func CallBackCache(name, redisKey string, funcs zredis.FuncType, opts ...zredis.Cache_func) ([]byte, error) {
+	return zredis.CallBackCacheWithCommander(GetCommander(name), redisKey, funcs, cacheOptions(name, opts)...)
+}
+
+// CallBackCacheIn 根据回源数据中的时间戳设置过期时间，选项同 CallBackCache
+func CallBackCacheIn(name, redisKey string, funcs zredis.FuncTypeInt, opts ...zredis.Cache_func) ([]byte, error) {
+	return zredis.CallBackCacheInWithCommander(GetCommander(name), redisKey, funcs, cacheOptions(name, opts)...)
+}
+
+// cacheOptions 以连接池名称作为回源合并的命名空间
+func cacheOptions(name string, opts []zredis.Cache_func) []zredis.Cache_func {
+	return append([]zredis.Cache_func{zredis.WithCacheNamespace(name)}, opts...)
+}
+
+// CommonRunScript 执行脚本，KEYS 数量不限
+func CommonRunScript(name string, script *zredis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(GetCommander(name), keys, args...)
 }
@@ -1,7 +1,11 @@
 package mredis
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/Xuzan9396/zredis"
 	"github.com/garyburd/redigo/redis"
 	"log"
 	"sync"
@@ -10,9 +14,9 @@ import (
 
 type RedisPool struct {
 	redis_pool *redis.Pool
-	maxActive  int
-	maxIdle    int
-	idleTime   time.Duration
+	config     *zredis.PoolConfig
+	codec      zredis.Codec
+	db         int
 }
 
 type Redis_func func(*RedisPool)
@@ -31,125 +35,156 @@ func init() {
 	}
 }
 
-// Conn 创建或获取指定名称的 Redis 连接池
-func Conn(name, conn, auth string, dbnum int, opts ...Redis_func) {
+// Conn 创建或获取指定名称的 Redis 连接池，连接、认证或选库失败时返回 *zredis.ConnError 且不保存连接池
+func Conn(name, conn, auth string, dbnum int, opts ...Redis_func) error {
 	// 如果已经存在该连接池，直接返回
-	redisManager.mu.RLock()
-	if _, exists := redisManager.pools[name]; exists {
-		redisManager.mu.RUnlock()
-		return
+	if exists(name) {
+		return nil
 	}
-	redisManager.mu.RUnlock()
 
 	// 创建新的连接池
-	redisPool := &RedisPool{
-		maxActive: 100,
-		maxIdle:   50,
-		idleTime:  300 * time.Second,
+	redisPool := newRedisPool(opts...)
+	redisPool.db = dbnum
+	pool := redisPool.config.NewPool(func() (redis.Conn, error) {
+		return redisPool.config.Dial(conn, auth, dbnum)
+	})
+	if err := redisPool.start(pool); err != nil {
+		return err
 	}
 
-	for _, opt := range opts {
-		opt(redisPool)
+	// 存储连接池
+	store(name, redisPool)
+	return nil
+}
+
+// ConnSentinel 通过哨兵发现主节点并创建指定名称的连接池，主从切换后自动连接新的主节点
+func ConnSentinel(name, masterName string, sentinelAddrs []string, auth string, dbnum int, opts ...Redis_func) error {
+	// 如果已经存在该连接池，直接返回
+	if exists(name) {
+		return nil
 	}
 
-	pool := &redis.Pool{
-		MaxActive:   redisPool.maxActive, // 最大活跃
-		MaxIdle:     redisPool.maxIdle,   // 最大空闲
-		IdleTimeout: redisPool.idleTime,  // 空闲连接超时
-		Wait:        false,               // true: 如果达到最大连接数，等待空闲连接 false: 直接返回错误
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial(
-				"tcp",
-				conn,
-				redis.DialConnectTimeout(time.Duration(5)*time.Second),
-				redis.DialReadTimeout(time.Duration(10)*time.Second),
-				redis.DialWriteTimeout(time.Duration(10)*time.Second),
-			)
-			if err != nil {
-				//zlog.F().Error("Redis 连接错误", err)
-				log.Println("Redis 连接错误", err)
-				return nil, err
-			}
-			//验证redis 是否有密码
-			if auth != "" {
-				if _, err := c.Do("AUTH", auth); err != nil {
-					c.Close()
-					//zlog.F().Fatalf("Connect to redis AUTH error: %v", err)
-					log.Println("Connect to redis AUTH error:", err)
-					return nil, err
-				}
-			}
-			c.Do("select", dbnum)
-			return c, nil
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
-			}
-			_, err := c.Do("PING")
-			return err
-		},
+	redisPool := newRedisPool(opts...)
+	redisPool.db = dbnum
+	redisPool.config.Sentinel = zredis.NewSentinel(masterName, sentinelAddrs)
+	pool := redisPool.config.NewPool(func() (redis.Conn, error) {
+		return redisPool.config.Sentinel.Dial(func(addr string) (redis.Conn, error) {
+			return redisPool.config.Dial(addr, auth, dbnum)
+		})
+	})
+
+	if err := redisPool.start(pool); err != nil {
+		return err
 	}
 
 	// 存储连接池
+	store(name, redisPool)
+	return nil
+}
+
+func exists(name string) bool {
+	redisManager.mu.RLock()
+	defer redisManager.mu.RUnlock()
+	_, ok := redisManager.pools[name]
+	return ok
+}
+
+// store 保存连接池，并发调用 Conn 时只保留先保存的连接池，后保存的连接池被关闭
+func store(name string, redisPool *RedisPool) {
 	redisManager.mu.Lock()
-	redisManager.pools[name] = &RedisPool{
-		redis_pool: pool,
-		maxActive:  redisPool.maxActive,
-		maxIdle:    redisPool.maxIdle,
-		idleTime:   redisPool.idleTime,
+	_, ok := redisManager.pools[name]
+	if !ok {
+		redisManager.pools[name] = redisPool
 	}
 	redisManager.mu.Unlock()
+	if ok {
+		redisPool.config.Tracker.Close(redisPool.redis_pool)
+	}
+}
+
+func newRedisPool(opts ...Redis_func) *RedisPool {
+	redisPool := &RedisPool{config: zredis.NewPoolConfig()}
+
+	for _, opt := range opts {
+		opt(redisPool)
+	}
+	return redisPool
+}
+
+// start 检查连接并预加载脚本，成功后启用 pool
+// 开启 WithLazyConnect 时失败不返回错误，在后台重试直到连接成功
+func (r *RedisPool) start(pool *redis.Pool) error {
+	r.redis_pool = pool
+	return r.config.Start(pool)
 }
 
 // 获取指定名称的 Redis 连接池
-func getPool(name string) (*redis.Pool, error) {
+func getPool(name string) (*RedisPool, error) {
 	redisManager.mu.RLock()
 	defer redisManager.mu.RUnlock()
 
 	if pool, exists := redisManager.pools[name]; exists {
-		return pool.redis_pool, nil
+		return pool, nil
 	}
 	return nil, fmt.Errorf("RedisPool not found: %s", name)
 }
 
+// getCodec 返回指定名称连接池的编解码器，未设置时为 nil
+func getCodec(name string) zredis.Codec {
+	redisManager.mu.RLock()
+	defer redisManager.mu.RUnlock()
+
+	if pool, exists := redisManager.pools[name]; exists {
+		return pool.codec
+	}
+	return nil
+}
+
+// getDB 返回指定名称连接池选择的数据库
+func getDB(name string) int {
+	redisManager.mu.RLock()
+	defer redisManager.mu.RUnlock()
+
+	if pool, exists := redisManager.pools[name]; exists {
+		return pool.db
+	}
+	return 0
+}
+
 // CommonCmd 执行通用的 Redis 命令
 func CommonCmd(name, cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
-	pool, err := getPool(name)
+	return CommonCmdCtx(context.Background(), name, cmdStr, keysAndArgs...)
+}
+
+// CommonCmdCtx 执行通用的 Redis 命令，遵守ctx的取消与截止时间
+func CommonCmdCtx(ctx context.Context, name, cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	c, err := getConn(ctx, name)
 	if err != nil {
-		//zlog.F().Errorf("获取 Redis 连接池失败: %v", err)
-		log.Println("获取 Redis 连接池失败:", err)
 		return nil, err
 	}
+	return zredis.DoContext(ctx, c, cmdStr, keysAndArgs...)
+}
 
-	if pool == nil {
-		//zlog.F().Errorf("Redis 连接池为空: %s", name)
-		log.Println("Redis 连接池为空:", name)
-		return nil, fmt.Errorf("redis pool is nil for name: %s", name)
-	}
+// CommonLuaScript 执行 Lua 脚本命令
+func CommonLuaScript(name, script string, key string, args ...interface{}) (reply interface{}, err error) {
+	return CommonLuaScriptCtx(context.Background(), name, script, key, args...)
+}
 
-	c := pool.Get()
-	if c == nil {
-		//zlog.F().Errorf("获取 Redis 连接失败: 连接为空")
-		log.Println("获取 Redis 连接失败: 连接为空")
-		return nil, fmt.Errorf("redis connection is nil")
-	}
-	if c.Err() != nil {
-		//zlog.F().Errorf("Redis DoCommonCmd: %v", c.Err())
-		log.Println("Redis DoCommonCmd:", c.Err())
-		return nil, c.Err()
+// CommonLuaScriptCtx 执行 Lua 脚本命令，遵守ctx的取消与截止时间
+func CommonLuaScriptCtx(ctx context.Context, name, script string, key string, args ...interface{}) (reply interface{}, err error) {
+	c, err := getConn(ctx, name)
+	if err != nil {
+		return nil, err
 	}
-	defer c.Close()
 
-	res, err := c.Do(cmdStr, keysAndArgs...)
-	if err == nil {
-		return res, err
-	}
-	return nil, err
+	lua := zredis.CachedScript(script)
+	return zredis.RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+		return lua.Do(c, []string{key}, args...)
+	})
 }
 
-// CommonLuaScript 执行 Lua 脚本命令
-func CommonLuaScript(name, script string, key string, args ...interface{}) (reply interface{}, err error) {
+// 从指定名称的连接池获取连接
+func getConn(ctx context.Context, name string) (redis.Conn, error) {
 	pool, err := getPool(name)
 	if err != nil {
 		//zlog.F().Errorf("获取 Redis 连接池失败: %v", err)
@@ -157,46 +192,171 @@ func CommonLuaScript(name, script string, key string, args ...interface{}) (repl
 		return nil, err
 	}
 
-	if pool == nil {
+	if pool.redis_pool == nil {
 		//zlog.F().Errorf("Redis 连接池为空: %s", name)
 		log.Println("Redis 连接池为空:", name)
 		return nil, fmt.Errorf("redis pool is nil for name: %s", name)
 	}
 
-	c := pool.Get()
-	if c == nil {
-		//zlog.F().Errorf("获取 Redis 连接失败: 连接为空")
-		log.Println("获取 Redis 连接失败: 连接为空")
-		return nil, fmt.Errorf("redis connection is nil")
+	c, err := pool.config.Tracker.Get(ctx, pool.redis_pool)
+	if err != nil {
+		//zlog.F().Errorf("获取 Redis 连接失败: %v", err)
+		log.Println("获取 Redis 连接失败:", err)
+		return nil, err
 	}
-	if c.Err() != nil {
-		//zlog.F().Errorf("LuaCommonCmd get redis error: %v", c.Err())
-		log.Println("LuaCommonCmd get redis error:", c.Err())
-		return nil, c.Err()
+	return c, nil
+}
+
+// Remove 移除指定名称的连接池并立即关闭所有连接，之后可以用同一名称重新 Conn
+func Remove(name string) error {
+	redisManager.mu.Lock()
+	pool, ok := redisManager.pools[name]
+	delete(redisManager.pools, name)
+	redisManager.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("RedisPool not found: %s", name)
 	}
-	defer c.Close()
+	return pool.config.Tracker.Close(pool.redis_pool)
+}
+
+// Close 关闭并移除所有连接池，正在执行的命令会返回错误
+func Close() error {
+	return closePools(func(pool *RedisPool) error {
+		return pool.config.Tracker.Close(pool.redis_pool)
+	})
+}
 
-	lua := redis.NewScript(1, script)
-	return lua.Do(c, append([]interface{}{key}, args...)...)
+// Shutdown 优雅关闭所有连接池：拒绝新的命令，立即关闭 Subscriber 等持有的订阅连接，等待执行中的命令（包括 BRPOP 等阻塞命令）结束后关闭连接并移除连接池，
+// ctx 结束时强制关闭剩余连接并返回 ctx.Err()
+func Shutdown(ctx context.Context) error {
+	return closePools(func(pool *RedisPool) error {
+		return pool.config.Tracker.Shutdown(ctx, pool.redis_pool)
+	})
+}
+
+// closePools 并发关闭所有连接池，关闭后从管理器中移除
+func closePools(closeFn func(pool *RedisPool) error) error {
+	redisManager.mu.RLock()
+	pools := make(map[string]*RedisPool, len(redisManager.pools))
+	for name, pool := range redisManager.pools {
+		pools[name] = pool
+	}
+	redisManager.mu.RUnlock()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for name, pool := range pools {
+		wg.Add(1)
+		go func(name string, pool *RedisPool) {
+			defer wg.Done()
+			err := closeFn(pool)
+			redisManager.mu.Lock()
+			if redisManager.pools[name] == pool {
+				delete(redisManager.pools, name)
+			}
+			redisManager.mu.Unlock()
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				mu.Unlock()
+			}
+		}(name, pool)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
 // WithMaxActive 设置最大活跃连接数
 func WithMaxActive(maxActive int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxActive = maxActive
+		r.config.MaxActive = maxActive
 	}
 }
 
 // WithMaxIdle 设置最大空闲连接数
 func WithMaxIdle(maxIdle int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxIdle = maxIdle
+		r.config.MaxIdle = maxIdle
 	}
 }
 
 // WithIdleTime 设置空闲连接超时时间
 func WithIdleTime(idleTime time.Duration) Redis_func {
 	return func(r *RedisPool) {
-		r.idleTime = idleTime
+		r.config.IdleTimeout = idleTime
+	}
+}
+
+// WithRedisOption 追加redis连接选项，在默认超时之后应用可以覆盖，不会覆盖 WithRedisTLS 和 ConnURL 地址参数中的选项
+func WithRedisOption(opts ...redis.DialOption) Redis_func {
+	return func(r *RedisPool) {
+		r.config.DialOptions = append(r.config.DialOptions, opts...)
+	}
+}
+
+// WithRedisTLSConfig 使用 TLS 连接，tlsConfig 为空时使用默认配置
+func WithRedisTLSConfig(tlsConfig *tls.Config) Redis_func {
+	return func(r *RedisPool) {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		r.config.DialOptions = append(r.config.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+	}
+}
+
+// WithUsername 设置 Redis 6 ACL 用户名，与密码一起使用 AUTH username password 认证
+func WithUsername(username string) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Username = username
+	}
+}
+
+// WithHelloAuth 使用 HELLO 2 AUTH 认证，服务端不支持 HELLO 时回退到 AUTH
+func WithHelloAuth() Redis_func {
+	return func(r *RedisPool) {
+		r.config.Hello = true
+	}
+}
+
+// WithCredentialsProvider 每次建立新连接时调用 provider 获取用户名和密码，覆盖 Conn 传入的密码和 WithUsername
+func WithCredentialsProvider(provider zredis.CredentialsProvider) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Credentials = provider
+	}
+}
+
+// WithWait 连接数达到 MaxActive 时等待空闲连接，默认 false 直接返回 redis.ErrPoolExhausted
+// 等待时间受 ctx 控制，等待次数和时间见 Stats
+func WithWait(wait bool) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Wait = wait
+	}
+}
+
+// WithLazyConnect 启动时连接失败不返回错误，每隔 retryInterval（指数退避）在后台重试直到连接成功，
+// 期间执行命令会返回连接错误，retryInterval <= 0 时为 1 秒
+func WithLazyConnect(retryInterval time.Duration) Redis_func {
+	return func(r *RedisPool) {
+		if retryInterval <= 0 {
+			retryInterval = time.Second
+		}
+		r.config.LazyRetry = retryInterval
+	}
+}
+
+// WithScripts 连接时使用 SCRIPT LOAD 预加载Lua脚本
+func WithScripts(scripts ...*zredis.Script) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Scripts = append(r.config.Scripts, scripts...)
+	}
+}
+
+// WithCodec 设置 SetObject/GetObject 等对象读写使用的编解码器，默认 zredis.JSONCodec
+func WithCodec(codec zredis.Codec) Redis_func {
+	return func(r *RedisPool) {
+		r.codec = codec
 	}
 }
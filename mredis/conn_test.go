@@ -1,8 +1,13 @@
 package mredis_test
 
 import (
+	"context"
+	"errors"
+	"github.com/Xuzan9396/zredis"
+	"github.com/Xuzan9396/zredis/internal/redistest"
 	"github.com/Xuzan9396/zredis/mredis"
 	"github.com/garyburd/redigo/redis"
+	"sync"
 	"testing"
 	"time"
 )
@@ -35,7 +40,11 @@ func TestRedisPool_CommonCmd(t *testing.T) {
 	conn := "127.0.0.1:6379"
 	passwd := "27252725"
 	dbnum := 0
-	mredis.Conn("redis1", conn, passwd, dbnum, mredis.WithIdleTime(60*time.Second))
+	if err := mredis.Conn("redis1", conn, passwd, dbnum, mredis.WithIdleTime(60*time.Second)); errors.Is(err, zredis.ErrDial) {
+		t.Skipf("redis not available: %v", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
 
 	mredis.CommonHset("redis1", "test_lua_hset", "coin", 100)
 	mredis.CommonHset("redis1", "test_lua_hset", "coin_free", 10)
@@ -48,3 +57,140 @@ func TestRedisPool_CommonCmd(t *testing.T) {
 
 	t.Log(resBytes, len(resBytes))
 }
+
+func TestConnURL(t *testing.T) {
+	if err := mredis.ConnURL("redis_url", "redis://:27252725@127.0.0.1:6379/1?dial_timeout=3s&pool_size=10"); errors.Is(err, zredis.ErrDial) {
+		t.Skipf("redis not available: %v", err)
+	} else if err != nil {
+		t.Fatalf("ConnURL err: %v", err)
+	}
+	defer mredis.Remove("redis_url")
+	mredis.CommonSet("redis_url", "test_conn_url", "v")
+	defer mredis.CommonDel("redis_url", "test_conn_url")
+	v, err := redis.String(mredis.CommonGet("redis_url", "test_conn_url"))
+	if err != nil || v != "v" {
+		t.Errorf("Expected v, got %q %v", v, err)
+	}
+
+	if err := mredis.ConnURL("redis_url_bad", "redis://:wrong@127.0.0.1:6379/0"); err == nil {
+		t.Error("Expected auth error")
+	}
+	if err := mredis.ConnURL("redis_url_bad", "redis://127.0.0.1:6379/x"); err == nil {
+		t.Error("Expected invalid url error")
+	}
+}
+
+func TestConn_Error(t *testing.T) {
+	s := redistest.NewServer(t, func(args []string) interface{} {
+		switch args[0] {
+		case "AUTH":
+			if args[1] != "secret" {
+				return redis.Error("WRONGPASS invalid username-password pair")
+			}
+		case "GET":
+			return []byte("v")
+		}
+		return "OK"
+	})
+	err := mredis.Conn("redis_auth_err", s.Addr(), "wrong", 0)
+	if !errors.Is(err, zredis.ErrAuth) {
+		t.Fatalf("Expected ErrAuth, got %v", err)
+	}
+	if _, err := mredis.CommonGet("redis_auth_err", "test_conn_error"); err == nil {
+		t.Error("Expected failed pool not stored")
+	}
+	if err := mredis.Conn("redis_auth_err", s.Addr(), "secret", 0); err != nil {
+		t.Errorf("Expected retry with the same name to succeed, got %v", err)
+	}
+	defer mredis.Remove("redis_auth_err")
+	if v, err := redis.String(mredis.CommonGet("redis_auth_err", "test_conn_error")); err != nil || v != "v" {
+		t.Errorf("Expected v, got %q %v", v, err)
+	}
+}
+
+func TestConn_Concurrent(t *testing.T) {
+	s := redistest.NewServer(t, func(args []string) interface{} {
+		return "OK"
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := mredis.Conn("redis_concurrent", s.Addr(), "secret", 0); err != nil {
+				t.Errorf("Conn err: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	defer mredis.Remove("redis_concurrent")
+
+	// 只保留一个连接池，其他并发创建的连接池被关闭
+	deadline := time.Now().Add(time.Second)
+	for s.OpenConns() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected one pool with one connection left, got %d connections", s.OpenConns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	if err := mredis.Conn("redis_remove", "127.0.0.1:6379", "27252725", 0); errors.Is(err, zredis.ErrDial) {
+		t.Skipf("redis not available: %v", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := mredis.Remove("redis_remove"); err != nil {
+		t.Fatalf("Remove err: %v", err)
+	}
+	if _, err := mredis.CommonGet("redis_remove", "test_remove"); err == nil {
+		t.Error("Expected error after Remove")
+	}
+	if err := mredis.Remove("redis_remove"); err == nil {
+		t.Error("Expected not found error")
+	}
+
+	if err := mredis.Conn("redis_remove", "127.0.0.1:6379", "27252725", 0); err != nil {
+		t.Fatalf("Expected reconnect with removed name, got %v", err)
+	}
+	defer mredis.Remove("redis_remove")
+	if _, err := mredis.CommonSet("redis_remove", "test_remove", "v"); err != nil {
+		t.Errorf("CommonSet err: %v", err)
+	}
+	mredis.CommonDel("redis_remove", "test_remove")
+}
+
+func TestHealthCheck(t *testing.T) {
+	s := redistest.NewServer(t, func(args []string) interface{} {
+		if args[0] == "PING" {
+			return "PONG"
+		}
+		return "OK"
+	})
+	if err := mredis.Conn("redis_health", s.Addr(), "secret", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer mredis.Remove("redis_health")
+	if err := mredis.Conn("redis_down", "127.0.0.1:1", "", 0, mredis.WithLazyConnect(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	defer mredis.Remove("redis_down")
+
+	if err := mredis.Ping(context.Background(), "redis_health"); err != nil {
+		t.Errorf("Ping err: %v", err)
+	}
+	report := mredis.HealthCheck(context.Background())
+	if report.Healthy {
+		t.Error("Expected unhealthy report with a pool down")
+	}
+	if h := report.Pools["redis_health"]; !h.Healthy || h.Stats.Dials == 0 {
+		t.Errorf("Unexpected health %+v", h)
+	}
+	if h := report.Pools["redis_down"]; h.Healthy || h.Error == "" || h.Stats.DialErrors == 0 {
+		t.Errorf("Unexpected health %+v", h)
+	}
+	if _, err := mredis.Stats("redis_missing"); err == nil {
+		t.Error("Expected not found error")
+	}
+}
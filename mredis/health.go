@@ -0,0 +1,72 @@
+package mredis
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Xuzan9396/zredis"
+)
+
+// HealthReport 所有连接池的健康检查结果，全部健康时 Healthy 为 true
+type HealthReport struct {
+	Healthy bool                     `json:"healthy"`
+	Pools   map[string]zredis.Health `json:"pools"`
+}
+
+// Stats 返回指定名称连接池的统计
+func Stats(name string) (zredis.PoolStats, error) {
+	pool, err := getPool(name)
+	if err != nil {
+		return zredis.PoolStats{}, err
+	}
+	return pool.config.Tracker.Stats(pool.redis_pool), nil
+}
+
+// AllStats 返回所有连接池的统计
+func AllStats() map[string]zredis.PoolStats {
+	redisManager.mu.RLock()
+	defer redisManager.mu.RUnlock()
+
+	stats := make(map[string]zredis.PoolStats, len(redisManager.pools))
+	for name, pool := range redisManager.pools {
+		stats[name] = pool.config.Tracker.Stats(pool.redis_pool)
+	}
+	return stats
+}
+
+// Ping 检查指定名称的连接池能否执行命令
+func Ping(ctx context.Context, name string) error {
+	return zredis.PingConn(ctx, connGetter(name))
+}
+
+// HealthCheck 并发检查所有连接池，返回汇总结果，可用于就绪探针
+func HealthCheck(ctx context.Context) HealthReport {
+	redisManager.mu.RLock()
+	names := make([]string, 0, len(redisManager.pools))
+	for name := range redisManager.pools {
+		names = append(names, name)
+	}
+	redisManager.mu.RUnlock()
+
+	report := HealthReport{Healthy: true, Pools: make(map[string]zredis.Health, len(names))}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			h := zredis.CheckHealth(ctx, connGetter(name))
+			h.Stats, _ = Stats(name)
+			mu.Lock()
+			report.Pools[name] = h
+			if !h.Healthy {
+				report.Healthy = false
+			}
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return report
+}
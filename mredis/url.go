@@ -0,0 +1,38 @@
+package mredis
+
+import (
+	"github.com/Xuzan9396/zredis"
+	"github.com/garyburd/redigo/redis"
+)
+
+// ConnURL 使用连接地址创建指定名称的连接池，地址格式见 zredis.ParseURL，opts 在地址参数之后应用
+//
+//	err := mredis.ConnURL("cache", "redis://:password@127.0.0.1:6379/2?pool_size=50")
+func ConnURL(name, rawURL string, opts ...Redis_func) error {
+	// 如果已经存在该连接池，直接返回
+	if exists(name) {
+		return nil
+	}
+
+	u, err := zredis.ParseURL(rawURL)
+	if err != nil {
+		return err
+	}
+	// 地址参数先于 opts 应用，opts 可以覆盖
+	redisPool := newRedisPool()
+	redisPool.config.ApplyURL(u)
+	for _, opt := range opts {
+		opt(redisPool)
+	}
+	redisPool.db = u.DB
+	pool := redisPool.config.NewPool(func() (redis.Conn, error) {
+		return redisPool.config.Dial(u.Addr, u.Password, u.DB)
+	})
+	if err := redisPool.start(pool); err != nil {
+		return err
+	}
+
+	// 存储连接池
+	store(name, redisPool)
+	return nil
+}
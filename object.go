@@ -0,0 +1,211 @@
+package zredis
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// codecOf 返回命令实例所属连接池的编解码器
+func codecOf(commander RedisCommander) Codec {
+	if c, ok := commander.(interface{ Codec() Codec }); ok {
+		if codec := c.Codec(); codec != nil {
+			return codec
+		}
+	}
+	return DefaultCodec
+}
+
+// SetObject 使用连接池的编解码器序列化 v 并写入 key，timeExpire 大于0时设置过期时间（秒）
+func SetObject(commander RedisCommander, key string, v interface{}, timeExpire int64) error {
+	data, err := codecOf(commander).Marshal(v)
+	if err != nil {
+		return err
+	}
+	if timeExpire > 0 {
+		_, err = commander.SetEx(key, data, timeExpire)
+	} else {
+		_, err = commander.Set(key, data)
+	}
+	return err
+}
+
+// GetObject 读取 key 并使用连接池的编解码器反序列化为 T，key 不存在时返回 ErrNil
+// T 为指针类型时（如 protobuf 消息）会自动分配
+func GetObject[T any](commander RedisCommander, key string) (T, error) {
+	var v T
+	data, err := redis.Bytes(commander.Get(key))
+	if err != nil {
+		return v, err
+	}
+	err = codecOf(commander).Unmarshal(data, newTarget(&v))
+	return v, err
+}
+
+// newTarget 返回反序列化的目标，T 为指针类型时分配新值
+func newTarget[T any](v *T) interface{} {
+	rt := reflect.TypeOf(*v)
+	if rt != nil && rt.Kind() == reflect.Pointer {
+		ptr := reflect.New(rt.Elem())
+		*v = ptr.Interface().(T)
+		return *v
+	}
+	return v
+}
+
+// HSetStruct 把结构体的字段写入哈希，字段名取 `redis` 标签，没有标签时使用字段名，`redis:"-"` 忽略该字段
+// 基础类型按字符串存储，其他类型使用连接池的编解码器序列化
+func HSetStruct(commander RedisCommander, key string, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("zredis: HSetStruct expects a struct, got %T", v)
+	}
+	codec := codecOf(commander)
+	args := []interface{}{key}
+	for _, f := range structFields(rv.Type()) {
+		val, err := encodeField(codec, rv.Field(f.index))
+		if err != nil {
+			return fmt.Errorf("zredis: encode field %s: %w", f.name, err)
+		}
+		args = append(args, f.name, val)
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	_, err := commander.Cmd("HSET", args...)
+	return err
+}
+
+// HGetAllStruct 读取哈希并填充到结构体 T，哈希不存在时返回 ErrNil
+func HGetAllStruct[T any](commander RedisCommander, key string) (T, error) {
+	var v T
+	values, err := redis.Values(commander.HgetAll(key))
+	if err != nil {
+		return v, err
+	}
+	if len(values) == 0 {
+		return v, ErrNil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(newTarget(&v)))
+	if rv.Kind() != reflect.Struct {
+		return v, fmt.Errorf("zredis: HGetAllStruct expects a struct, got %T", v)
+	}
+	fields := make(map[string]int)
+	for _, f := range structFields(rv.Type()) {
+		fields[f.name] = f.index
+	}
+	codec := codecOf(commander)
+	for i := 0; i+1 < len(values); i += 2 {
+		name, _ := redis.String(values[i], nil)
+		index, ok := fields[name]
+		if !ok {
+			continue
+		}
+		data, _ := redis.Bytes(values[i+1], nil)
+		if err := decodeField(codec, data, rv.Field(index)); err != nil {
+			return v, fmt.Errorf("zredis: decode field %s: %w", name, err)
+		}
+	}
+	return v, nil
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("redis"); tag != "" {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
+
+func encodeField(codec Codec, v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+	}
+	return codec.Marshal(v.Interface())
+}
+
+func decodeField(codec Codec, data []byte, v reflect.Value) error {
+	s := string(data)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+	}
+	if v.Kind() == reflect.Pointer {
+		ptr := reflect.New(v.Type().Elem())
+		if err := codec.Unmarshal(data, ptr.Interface()); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	return codec.Unmarshal(data, v.Addr().Interface())
+}
@@ -0,0 +1,154 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrQueued 管道或事务中的命令已入队，真正的结果由 Exec 返回
+// SIsMember、ZAddBool、XAdd 等类型化方法入队时返回该错误，可以与 false、ErrNil 等真实结果区分
+var ErrQueued = errors.New("zredis: command queued, result is returned by Exec")
+
+// ConnGetter 获取一个独占的连接，调用方使用完毕后负责关闭
+type ConnGetter func(ctx context.Context) (redis.Conn, error)
+
+// PipelineResult 管道中单条命令的执行结果
+type PipelineResult struct {
+	Cmd   string
+	Args  []interface{}
+	Reply interface{}
+	Err   error
+}
+
+// Result 返回命令的结果，便于配合 redis.Int64 等函数转换类型
+func (r PipelineResult) Result() (interface{}, error) {
+	return r.Reply, r.Err
+}
+
+type pipelineCmd struct {
+	cmd  string
+	args []interface{}
+}
+
+// Pipeline 管道，先缓存命令，Exec 时在同一个连接上通过 Send/Flush/Receive 一次往返发送
+// 通过嵌入的 RedisCommander 调用的命令只会入队并返回 ErrQueued，真正的结果由 Exec 返回，
+// 只返回 bool 的 Hexists 无法区分入队和不存在，DelPattern 需要中间结果，都不适用于管道
+// Pipeline 不是并发安全的
+type Pipeline struct {
+	RedisCommander
+	getConn ConnGetter
+	cmds    []pipelineCmd
+}
+
+// NewPipeline 基于全局连接池创建管道
+func NewPipeline() *Pipeline {
+	return NewPipelineWithConn(getConn)
+}
+
+// NewPipelineWithConn 使用指定的连接获取函数创建管道
+func NewPipelineWithConn(getConn ConnGetter) *Pipeline {
+	p := &Pipeline{getConn: getConn}
+	p.RedisCommander = NewRedisCommands(p.queue, p.queueLua, withQueuedCommands())
+	return p
+}
+
+func (p *Pipeline) queue(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	p.cmds = append(p.cmds, pipelineCmd{cmd: cmdStr, args: keysAndArgs})
+	return nil, ErrQueued
+}
+
+func (p *Pipeline) queueLua(script string, key string, args ...interface{}) (interface{}, error) {
+	return p.queue("EVAL", append([]interface{}{script, 1, key}, args...)...)
+}
+
+func (p *Pipeline) queuesCommands() bool {
+	return true
+}
+
+// Len 返回已入队的命令数量
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard 丢弃所有已入队的命令
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Exec 在同一个连接上发送所有已入队的命令并按顺序返回每条命令的结果
+// 返回的 error 为第一个出错命令的错误，各命令的错误同时记录在对应的 PipelineResult 中
+// 执行后管道会被清空，可以继续复用
+func (p *Pipeline) Exec(ctx context.Context) ([]PipelineResult, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	c, err := p.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PipelineResult, len(cmds))
+	for i, cmd := range cmds {
+		results[i] = PipelineResult{Cmd: cmd.cmd, Args: cmd.args}
+	}
+	_, err = RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+		return nil, execPipeline(ctx, c, results)
+	})
+	if err != nil {
+		// ctx 取消时结果仍在后台写入，不能返回给调用方
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return results, err
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			return results, res.Err
+		}
+	}
+	return results, nil
+}
+
+// execPipeline 发送并读取管道命令，返回连接级别的错误
+func execPipeline(ctx context.Context, c redis.Conn, results []PipelineResult) error {
+	for _, res := range results {
+		if err := c.Send(res.Cmd, res.Args...); err != nil {
+			return failPipeline(results, 0, err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return failPipeline(results, 0, err)
+	}
+	for i := range results {
+		reply, err := receiveContext(ctx, c)
+		if err != nil {
+			if _, ok := err.(redis.Error); !ok {
+				return failPipeline(results, i, err)
+			}
+		}
+		results[i].Reply, results[i].Err = reply, err
+	}
+	return nil
+}
+
+// failPipeline 连接出错时，把从 from 开始的所有命令标记为失败
+func failPipeline(results []PipelineResult, from int, err error) error {
+	for i := from; i < len(results); i++ {
+		results[i].Err = err
+	}
+	return err
+}
+
+// receiveContext 读取一条回复，ctx 带截止时间时按剩余时间设置读超时
+func receiveContext(ctx context.Context, c redis.Conn) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.ReceiveWithTimeout(c, time.Until(deadline))
+	}
+	return c.Receive()
+}
@@ -0,0 +1,169 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 模拟的管道连接，Send 的命令按顺序由 reply 生成回复
+type pipeConn struct {
+	sent    []string
+	pending []string
+	reply   func(cmd string, args []interface{}) (interface{}, error)
+	args    [][]interface{}
+	closed  bool
+	err     error
+}
+
+func (c *pipeConn) Close() error { c.closed = true; return nil }
+func (c *pipeConn) Err() error   { return c.err }
+func (c *pipeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return nil, c.Flush()
+	}
+	if err := c.Send(cmd, args...); err != nil {
+		return nil, err
+	}
+	return c.Receive()
+}
+func (c *pipeConn) Send(cmd string, args ...interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, cmd)
+	c.pending = append(c.pending, cmd)
+	c.args = append(c.args, args)
+	return nil
+}
+func (c *pipeConn) Flush() error { return c.err }
+func (c *pipeConn) Receive() (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.pending) == 0 {
+		return nil, errors.New("no pending reply")
+	}
+	cmd := c.pending[0]
+	args := c.args[len(c.sent)-len(c.pending)]
+	c.pending = c.pending[1:]
+	if c.reply != nil {
+		return c.reply(cmd, args)
+	}
+	return "OK", nil
+}
+func (c *pipeConn) ReceiveWithTimeout(time.Duration) (interface{}, error) { return c.Receive() }
+
+func newPipeConnGetter(c *pipeConn) ConnGetter {
+	return func(ctx context.Context) (redis.Conn, error) {
+		return c, nil
+	}
+}
+
+func TestPipeline_Exec(t *testing.T) {
+	conn := &pipeConn{reply: func(cmd string, args []interface{}) (interface{}, error) {
+		switch cmd {
+		case "HSET":
+			return int64(1), nil
+		case "GET":
+			return nil, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		return "OK", nil
+	}}
+	p := NewPipelineWithConn(newPipeConnGetter(conn))
+	if ok, err := p.SIsMember("test:set", "m"); ok || err != ErrQueued {
+		t.Errorf("Expected typed command to return ErrQueued, got %v %v", ok, err)
+	}
+	if id, err := p.XAdd(XAddArgs{Stream: "test:stream", Values: map[string]interface{}{"v": 1}}); id != "" || err != ErrQueued {
+		t.Errorf("Expected stream command to return ErrQueued, got %q %v", id, err)
+	}
+	p.Discard()
+	res, err := p.Hset("test:hash", "f1", "v1")
+	if res != nil || err != ErrQueued {
+		t.Errorf("Expected queued command to return ErrQueued, got %v %v", res, err)
+	}
+	p.Hset("test:hash", "f2", "v2")
+	p.Get("test:hash")
+	p.Set("test:key1", "value1")
+	if p.Len() != 4 {
+		t.Errorf("Expected 4 queued commands, got %d", p.Len())
+	}
+	if len(conn.sent) != 0 {
+		t.Errorf("Expected no command sent before Exec")
+	}
+
+	results, err := p.Exec(context.Background())
+	if err == nil {
+		t.Errorf("Expected first command error to be returned")
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	if n, _ := redis.Int64(results[0].Result()); n != 1 {
+		t.Errorf("Expected 1, got %v", results[0].Reply)
+	}
+	if results[2].Err == nil {
+		t.Errorf("Expected GET to fail")
+	}
+	if results[3].Reply != "OK" || results[3].Err != nil {
+		t.Errorf("Expected 'OK', got %v %v", results[3].Reply, results[3].Err)
+	}
+	if !conn.closed {
+		t.Errorf("Expected connection to be closed")
+	}
+	if p.Len() != 0 {
+		t.Errorf("Expected pipeline to be reset after Exec")
+	}
+}
+
+func TestPipeline_ConnError(t *testing.T) {
+	connErr := errors.New("connection reset")
+	conn := &pipeConn{err: connErr}
+	p := NewPipelineWithConn(newPipeConnGetter(conn))
+	p.Set("test:key1", "value1")
+	p.Set("test:key2", "value2")
+	results, err := p.Exec(context.Background())
+	if !errors.Is(err, connErr) {
+		t.Errorf("Expected connection error, got %v", err)
+	}
+	for i, res := range results {
+		if !errors.Is(res.Err, connErr) {
+			t.Errorf("Expected result %d to carry connection error, got %v", i, res.Err)
+		}
+	}
+}
+
+func TestPipeline_LuaScript(t *testing.T) {
+	conn := &pipeConn{}
+	p := NewPipelineWithConn(newPipeConnGetter(conn))
+	p.LuaScript("return KEYS[1]", "test:lua", 1)
+	// 入队时无法根据 NOSCRIPT 回退，Script 和使用脚本的命令都应入队 EVAL
+	script := NewScript("return ARGV[1]")
+	if _, err := script.Run(p, []string{"test:lua"}, 1); err != ErrQueued {
+		t.Errorf("Expected script to be queued, got %v", err)
+	}
+	p.ZIncrByExpire("test:zset", 1, "member", 60)
+	if _, err := p.Exec(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(conn.sent) != 3 || conn.sent[0] != "EVAL" || conn.sent[1] != "EVAL" || conn.sent[2] != "EVAL" {
+		t.Errorf("Expected EVAL to be sent, got %v", conn.sent)
+	}
+	if conn.args[1][0] != script.Src() {
+		t.Errorf("Expected script source to be sent, got %v", conn.args[1][0])
+	}
+}
+
+func TestPipeline_Empty(t *testing.T) {
+	p := NewPipelineWithConn(func(ctx context.Context) (redis.Conn, error) {
+		t.Errorf("Expected no connection for empty pipeline")
+		return nil, nil
+	})
+	results, err := p.Exec(context.Background())
+	if err != nil || results != nil {
+		t.Errorf("Expected empty result, got %v %v", results, err)
+	}
+}
@@ -0,0 +1,177 @@
+package zredis
+
+import (
+	"log"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// PoolConfig 全局、单实例和多实例模式共用的连接池配置，负责建立连接、创建连接池、启动检查和延迟重连
+type PoolConfig struct {
+	MaxActive   int
+	MaxIdle     int
+	IdleTimeout time.Duration
+	// Wait 连接数达到 MaxActive 时等待空闲连接
+	Wait bool
+
+	// Network 为空时使用 "tcp"
+	Network     string
+	DialOptions []redis.DialOption
+	Username    string
+	// Hello 使用 HELLO 2 AUTH 认证
+	Hello bool
+	// Credentials 不为空时每次建立连接都调用，覆盖 Dial 传入的密码和 Username
+	Credentials CredentialsProvider
+	// Scripts 启动时预加载的Lua脚本
+	Scripts []*Script
+	// Sentinel 不为空时借出连接前检查主节点是否已经切换
+	Sentinel *Sentinel
+	// LazyRetry 大于 0 时启动失败不返回错误，在后台按指数退避重试
+	LazyRetry time.Duration
+	Tracker   *ConnTracker
+}
+
+// NewPoolConfig 返回默认的连接池配置
+func NewPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		MaxActive:   100,
+		MaxIdle:     50,
+		IdleTimeout: 300 * time.Second,
+		Tracker:     NewConnTracker(),
+	}
+}
+
+// ApplyURL 使用 ParseURL 的解析结果设置连接和连接池参数，密码和数据库由调用方传给 Dial
+func (c *PoolConfig) ApplyURL(u *RedisURL) {
+	c.Network = u.Network
+	c.DialOptions = append(c.DialOptions, u.DialOptions...)
+	if u.TLSConfig != nil {
+		c.DialOptions = append(c.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(u.TLSConfig))
+	}
+	if u.Username != "" {
+		c.Username = u.Username
+	}
+	if u.MaxActive > 0 {
+		c.MaxActive = u.MaxActive
+	}
+	if u.MaxIdle > 0 {
+		c.MaxIdle = u.MaxIdle
+	}
+	if u.IdleTimeout > 0 {
+		c.IdleTimeout = u.IdleTimeout
+	}
+}
+
+// Dial 建立到 addr 的连接并完成认证和选库，失败时返回 *ConnError
+func (c *PoolConfig) Dial(addr, auth string, dbnum int) (redis.Conn, error) {
+	username, password := c.Username, auth
+	if c.Credentials != nil {
+		var err error
+		if username, password, err = c.Credentials(); err != nil {
+			return nil, &ConnError{Kind: ErrAuth, Addr: addr, Err: err}
+		}
+	}
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(time.Duration(5) * time.Second),
+		redis.DialReadTimeout(time.Duration(10) * time.Second),
+		redis.DialWriteTimeout(time.Duration(10) * time.Second),
+	}
+	options = append(options, c.DialOptions...)
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	conn, err := redis.Dial(network, addr, options...)
+	if err != nil {
+		return nil, &ConnError{Kind: ErrDial, Addr: addr, Err: err}
+	}
+	//验证redis 是否有密码
+	if err := Authenticate(conn, username, password, c.Hello); err != nil {
+		conn.Close()
+		return nil, &ConnError{Kind: ErrAuth, Addr: addr, Err: err}
+	}
+	// 新连接默认就是 0 号库，不发送 SELECT 以兼容不支持该命令的代理和集群
+	if dbnum != 0 {
+		if _, err := conn.Do("SELECT", dbnum); err != nil {
+			conn.Close()
+			return nil, &ConnError{Kind: ErrSelectDB, Addr: addr, Err: err}
+		}
+	}
+	return c.Tracker.Track(conn), nil
+}
+
+// NewPool 创建使用 dial 建立连接的连接池
+func (c *PoolConfig) NewPool(dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:   c.MaxActive,   // 最大活跃 假设应用在高并发场景下，最大并发请求数为 1000，那么可以将 MaxActive 设置为 2000-3000。
+		MaxIdle:     c.MaxIdle,     // 最大空闲 ,一般启动时候保持的链接数
+		IdleTimeout: c.IdleTimeout, // 空闲连接超时 超过这个时间会关闭空闲链接
+		Wait:        c.Wait,        // true: 如果达到最大连接数，等待空闲连接 false: 直接返回错误
+		Dial: func() (redis.Conn, error) {
+			return c.Tracker.Dial(dial)
+		},
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			// 主从切换后丢弃指向旧主节点的连接
+			if err := c.Sentinel.TestOnBorrow(conn); err != nil {
+				return err
+			}
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+}
+
+// Start 检查 pool 可用并预加载脚本，失败时关闭 pool 并返回错误
+// LazyRetry 大于 0 时失败不返回错误，在后台重试直到连接成功或连接池关闭
+func (c *PoolConfig) Start(pool *redis.Pool) error {
+	err := c.check(pool)
+	if err == nil {
+		return nil
+	}
+	if c.LazyRetry <= 0 {
+		pool.Close() // 关闭连接池避免资源泄露
+		return err
+	}
+	log.Printf("redis connect err:%v, retry in background", err)
+	go c.retryConnect(pool)
+	return nil
+}
+
+// check 获取一个连接确认服务端可用并预加载Lua脚本，预加载失败时执行脚本会自动回退到 EVAL
+func (c *PoolConfig) check(pool *redis.Pool) error {
+	conn := pool.Get()
+	defer conn.Close()
+	if err := conn.Err(); err != nil {
+		return err
+	}
+	for _, script := range c.Scripts {
+		if err := script.LoadConn(conn); err != nil {
+			log.Printf("load script %s err:%v", script.Hash(), err)
+		}
+	}
+	return nil
+}
+
+// retryConnect 按指数退避重试连接，最长间隔 30 秒
+func (c *PoolConfig) retryConnect(pool *redis.Pool) {
+	interval := c.LazyRetry
+	for {
+		time.Sleep(interval)
+		if c.Tracker.Closed() {
+			return
+		}
+		err := c.check(pool)
+		if err == nil {
+			log.Println("redis connected")
+			return
+		}
+		log.Printf("redis connect err:%v, retry in %v", err, interval)
+		if interval *= 2; interval > 30*time.Second {
+			interval = 30 * time.Second
+		}
+	}
+}
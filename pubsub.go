@@ -0,0 +1,348 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrSubscriberClosed 订阅者已关闭
+var ErrSubscriberClosed = errors.New("zredis: subscriber closed")
+
+// subscriberStopPing 停止时发送的 PING 参数，收到它的回复说明之前的退订已全部完成
+const subscriberStopPing = "zredis-subscriber-stop"
+
+type subscriberOptions struct {
+	pingInterval time.Duration
+	retryBackoff time.Duration
+	bufferSize   int
+}
+
+// Subscriber_func 订阅者的配置选项
+type Subscriber_func func(*subscriberOptions)
+
+// WithSubscriberPingInterval 设置心跳间隔，超过两个间隔没有收到任何回复时认为连接已断开，默认 30 秒
+func WithSubscriberPingInterval(interval time.Duration) Subscriber_func {
+	return func(o *subscriberOptions) {
+		o.pingInterval = interval
+	}
+}
+
+// WithSubscriberRetryBackoff 设置连接断开后重连的间隔，默认 1 秒
+func WithSubscriberRetryBackoff(backoff time.Duration) Subscriber_func {
+	return func(o *subscriberOptions) {
+		o.retryBackoff = backoff
+	}
+}
+
+// WithSubscriberBufferSize 设置消息通道的缓冲大小，默认 100，通道满时暂停读取连接
+func WithSubscriberBufferSize(size int) Subscriber_func {
+	return func(o *subscriberOptions) {
+		o.bufferSize = size
+	}
+}
+
+// Message 订阅收到的消息
+type Message struct {
+	// Kind 为 "message"、"pmessage" 或 "smessage"
+	Kind    string
+	Channel string
+	// Pattern PSUBSCRIBE 匹配的模式，其他订阅为空
+	Pattern string
+	Payload []byte
+}
+
+// Subscriber 使用专用连接的订阅者，支持 SUBSCRIBE、PSUBSCRIBE 和 SSUBSCRIBE
+// 定期 PING 检测连接，断开后自动重连并重新订阅所有频道，消息通过 Messages 返回的通道投递
+// 集群模式下 SSUBSCRIBE 的频道需要位于连接所在的节点
+type Subscriber struct {
+	getConn ConnGetter
+	opts    subscriberOptions
+
+	mu       sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	shards   map[string]struct{}
+	conn     redis.Conn
+	// wmu 串行化连接上的写操作，读由 listen 独占
+	wmu sync.Mutex
+
+	messages chan Message
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewSubscriber 创建基于全局连接池的订阅者
+func NewSubscriber(opts ...Subscriber_func) *Subscriber {
+	return NewSubscriberWithConn(getConn, opts...)
+}
+
+// NewSubscriberWithConn 创建订阅者，getConn 用于获取订阅的专用连接
+func NewSubscriberWithConn(getConn ConnGetter, opts ...Subscriber_func) *Subscriber {
+	s := &Subscriber{
+		getConn: getConn,
+		opts: subscriberOptions{
+			pingInterval: 30 * time.Second,
+			retryBackoff: time.Second,
+			bufferSize:   100,
+		},
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		shards:   make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.messages = make(chan Message, s.opts.bufferSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.run(ctx)
+	return s
+}
+
+// Messages 返回消息通道，Close 或连接池关闭后关闭
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Subscribe 订阅频道，连接断开重连后自动重新订阅
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.update(s.channels, true, "SUBSCRIBE", channels)
+}
+
+// Unsubscribe 退订频道
+func (s *Subscriber) Unsubscribe(channels ...string) error {
+	return s.update(s.channels, false, "UNSUBSCRIBE", channels)
+}
+
+// PSubscribe 按模式订阅频道
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.update(s.patterns, true, "PSUBSCRIBE", patterns)
+}
+
+// PUnsubscribe 退订模式
+func (s *Subscriber) PUnsubscribe(patterns ...string) error {
+	return s.update(s.patterns, false, "PUNSUBSCRIBE", patterns)
+}
+
+// SSubscribe 订阅分片频道（Redis 7.0+）
+func (s *Subscriber) SSubscribe(channels ...string) error {
+	return s.update(s.shards, true, "SSUBSCRIBE", channels)
+}
+
+// SUnsubscribe 退订分片频道
+func (s *Subscriber) SUnsubscribe(channels ...string) error {
+	return s.update(s.shards, false, "SUNSUBSCRIBE", channels)
+}
+
+// Close 退订所有频道并关闭连接和消息通道
+func (s *Subscriber) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// update 更新订阅集合，已连接时立即发送命令，未连接时在连接后统一订阅
+func (s *Subscriber) update(set map[string]struct{}, add bool, cmd string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return ErrSubscriberClosed
+	default:
+	}
+	for _, name := range names {
+		if add {
+			set[name] = struct{}{}
+		} else {
+			delete(set, name)
+		}
+	}
+	c := s.conn
+	s.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+	return s.send(c, cmd, stringArgs(names)...)
+}
+
+func (s *Subscriber) send(c redis.Conn, cmd string, args ...interface{}) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := c.Send(cmd, args...); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// run 保持订阅连接，断开后按间隔重连
+func (s *Subscriber) run(ctx context.Context) {
+	defer func() {
+		s.mu.Lock()
+		close(s.done)
+		s.mu.Unlock()
+		close(s.messages)
+	}()
+	for {
+		err := s.listen(ctx)
+		// 连接池关闭后不再重连，关闭消息通道通知使用方
+		if ctx.Err() != nil || errors.Is(err, ErrPoolClosed) {
+			return
+		}
+		log.Printf("subscriber connection err:%v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.retryBackoff):
+		}
+	}
+}
+
+func (s *Subscriber) listen(ctx context.Context) error {
+	c, err := s.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	dedicateConn(c)
+
+	// 先登记连接再读取订阅集合，期间新增的订阅要么在集合中，要么由 update 直接发送
+	s.mu.Lock()
+	s.conn = c
+	channels, patterns, shards := setArgs(s.channels), setArgs(s.patterns), setArgs(s.shards)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}()
+
+	s.wmu.Lock()
+	if len(channels) > 0 {
+		c.Send("SUBSCRIBE", channels...)
+	}
+	if len(patterns) > 0 {
+		c.Send("PSUBSCRIBE", patterns...)
+	}
+	if len(shards) > 0 {
+		c.Send("SSUBSCRIBE", shards...)
+	}
+	err = c.Flush()
+	s.wmu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 退出前等待心跳协程结束，避免与连接关闭并发写
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.opts.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// 退订全部频道，收到停止 PING 的回复后读取结束，连接可以安全归还连接池
+				s.wmu.Lock()
+				c.Send("UNSUBSCRIBE")
+				c.Send("PUNSUBSCRIBE")
+				if s.hasShards() {
+					c.Send("SUNSUBSCRIBE")
+				}
+				c.Send("PING", subscriberStopPing)
+				c.Flush()
+				s.wmu.Unlock()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.send(c, "PING")
+			}
+		}
+	}()
+
+	for {
+		reply, err := redis.ReceiveWithTimeout(c, 2*s.opts.pingInterval)
+		if err != nil {
+			return err
+		}
+		switch reply := reply.(type) {
+		case []byte:
+			// 没有任何订阅时 PING 返回普通回复
+			if ctx.Err() != nil && string(reply) == subscriberStopPing {
+				return ctx.Err()
+			}
+		case []interface{}:
+			if len(reply) < 2 {
+				continue
+			}
+			kind, _ := redis.String(reply[0], nil)
+			switch kind {
+			case "pong":
+				if payload, _ := redis.String(reply[1], nil); ctx.Err() != nil && payload == subscriberStopPing {
+					return ctx.Err()
+				}
+			case "message", "smessage":
+				if len(reply) >= 3 {
+					msg := Message{Kind: kind}
+					msg.Channel, _ = redis.String(reply[1], nil)
+					msg.Payload, _ = redis.Bytes(reply[2], nil)
+					s.deliver(ctx, msg)
+				}
+			case "pmessage":
+				if len(reply) >= 4 {
+					msg := Message{Kind: kind}
+					msg.Pattern, _ = redis.String(reply[1], nil)
+					msg.Channel, _ = redis.String(reply[2], nil)
+					msg.Payload, _ = redis.Bytes(reply[3], nil)
+					s.deliver(ctx, msg)
+				}
+			}
+		}
+	}
+}
+
+// deliver 投递消息，停止期间丢弃剩余消息
+func (s *Subscriber) deliver(ctx context.Context, msg Message) {
+	select {
+	case s.messages <- msg:
+	case <-ctx.Done():
+	}
+}
+
+func (s *Subscriber) hasShards() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.shards) > 0
+}
+
+func setArgs(set map[string]struct{}) []interface{} {
+	args := make([]interface{}, 0, len(set))
+	for name := range set {
+		args = append(args, name)
+	}
+	return args
+}
+
+func stringArgs(values []string) []interface{} {
+	return appendStrings(make([]interface{}, 0, len(values)), values...)
+}
@@ -0,0 +1,136 @@
+package zredis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func receiveMessage(t *testing.T, s *Subscriber) Message {
+	t.Helper()
+	select {
+	case msg := <-s.Messages():
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+	return Message{}
+}
+
+// publishUntil 重复发布直到有订阅者收到，订阅命令是异步发送的
+func publishUntil(t *testing.T, commander RedisCommander, channel, message string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		n, err := commander.Publish(channel, message)
+		if err != nil {
+			t.Fatalf("Publish err: %v", err)
+		}
+		if n > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("No subscriber received %s", channel)
+}
+
+func TestSubscriber_SubscribeAndPattern(t *testing.T) {
+	commander, getConn := newRedisTestCommander(t)
+	s := NewSubscriberWithConn(getConn)
+	defer s.Close()
+
+	if err := s.Subscribe("test:pubsub:a"); err != nil {
+		t.Fatalf("Subscribe err: %v", err)
+	}
+	if err := s.PSubscribe("test:pubsub:p:*"); err != nil {
+		t.Fatalf("PSubscribe err: %v", err)
+	}
+
+	publishUntil(t, commander, "test:pubsub:a", "hello")
+	msg := receiveMessage(t, s)
+	if msg.Kind != "message" || msg.Channel != "test:pubsub:a" || string(msg.Payload) != "hello" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+
+	publishUntil(t, commander, "test:pubsub:p:1", "world")
+	msg = receiveMessage(t, s)
+	if msg.Kind != "pmessage" || msg.Pattern != "test:pubsub:p:*" || msg.Channel != "test:pubsub:p:1" || string(msg.Payload) != "world" {
+		t.Errorf("Unexpected pattern message %+v", msg)
+	}
+
+	s.Unsubscribe("test:pubsub:a")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, _ := commander.Publish("test:pubsub:a", "x"); n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n, _ := commander.Publish("test:pubsub:a", "x"); n != 0 {
+		t.Errorf("Expected no subscribers after Unsubscribe, got %d", n)
+	}
+}
+
+func TestSubscriber_Resubscribe(t *testing.T) {
+	commander, _ := newRedisTestCommander(t)
+	var mu sync.Mutex
+	var conns []redis.Conn
+	getConn := func(ctx context.Context) (redis.Conn, error) {
+		c, err := redis.Dial("tcp", "127.0.0.1:6379", redis.DialPassword("27252725"))
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		conns = append(conns, c)
+		mu.Unlock()
+		return c, nil
+	}
+	s := NewSubscriberWithConn(getConn, WithSubscriberRetryBackoff(10*time.Millisecond))
+	defer s.Close()
+	s.Subscribe("test:pubsub:reconnect")
+	publishUntil(t, commander, "test:pubsub:reconnect", "before")
+	receiveMessage(t, s)
+
+	// 模拟连接断开
+	mu.Lock()
+	conns[0].Close()
+	mu.Unlock()
+
+	publishUntil(t, commander, "test:pubsub:reconnect", "after")
+	if msg := receiveMessage(t, s); string(msg.Payload) != "after" {
+		t.Errorf("Unexpected message after reconnect %+v", msg)
+	}
+	mu.Lock()
+	n := len(conns)
+	mu.Unlock()
+	if n < 2 {
+		t.Errorf("Expected a new connection, got %d", n)
+	}
+}
+
+func TestSubscriber_Close(t *testing.T) {
+	_, getConn := newRedisTestCommander(t)
+	s := NewSubscriberWithConn(getConn, WithSubscriberPingInterval(50*time.Millisecond))
+	s.Subscribe("test:pubsub:close")
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if _, ok := <-s.Messages(); ok {
+		t.Error("Expected message channel to be closed")
+	}
+	if err := s.Subscribe("x"); err != ErrSubscriberClosed {
+		t.Errorf("Expected ErrSubscriberClosed, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package zredis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrJobNotFound 确认或重试的任务不在处理列表中，可能已被回收
+var ErrJobNotFound = errors.New("zredis: job not found in processing list")
+
+// 任务在列表中的格式为 32 位十六进制 id + ":" + 之前的投递次数 + ":" + 内容
+// 投递次数只在 Nack 和回收时由脚本原子改写，Pop 不需要额外的命令
+const jobIDLen = 32
+
+// queueRedeliverLua 把处理失败的任务的投递次数加一，返回新的任务值和是否达到最大投递次数
+// 格式不符的值整体作为内容，与 parseJob 一致
+const queueRedeliverLua = `
+local function redeliver(raw, max)
+	local id = string.sub(raw, 1, 32)
+	local attempts, body = string.match(raw, "^:(%d+):(.*)$", 33)
+	if attempts then
+		attempts = tonumber(attempts) + 1
+	else
+		attempts, body = 1, raw
+	end
+	return id .. ":" .. attempts .. ":" .. body, attempts >= max
+end
+`
+
+// queueNackScript 从处理列表取回任务，达到最大投递次数时原样进入死信列表，否则增加投递次数后放回队尾
+// KEYS: processing, pending, dead  ARGV: raw, maxAttempts
+var queueNackScript = NewScript(queueRedeliverLua + `
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+	return -1
+end
+local raw, dead = redeliver(ARGV[1], tonumber(ARGV[2]))
+if dead then
+	redis.call("LPUSH", KEYS[3], ARGV[1])
+	return 1
+end
+redis.call("LPUSH", KEYS[2], raw)
+return 0
+`)
+
+// queueReapScript 回收 worker 处理列表中的任务，心跳在 deadline 之后的 worker 跳过
+// KEYS: pending, workers, dead, 每个 worker 的 processing  ARGV: maxAttempts, deadline(ms), 每个 worker
+var queueReapScript = NewScript(queueRedeliverLua + `
+local max = tonumber(ARGV[1])
+local deadline = tonumber(ARGV[2])
+local n = 0
+for i = 3, #ARGV do
+	local w = ARGV[i]
+	local score = redis.call("ZSCORE", KEYS[2], w)
+	if not score or tonumber(score) <= deadline then
+		while true do
+			local raw = redis.call("RPOP", KEYS[i + 1])
+			if not raw then
+				break
+			end
+			local next, dead = redeliver(raw, max)
+			if dead then
+				redis.call("LPUSH", KEYS[3], raw)
+			else
+				redis.call("RPUSH", KEYS[1], next)
+			end
+			n = n + 1
+		end
+		redis.call("ZREM", KEYS[2], w)
+	end
+end
+return n
+`)
+
+type queueOptions struct {
+	visibilityTimeout time.Duration
+	maxAttempts       int
+	popTimeout        time.Duration
+}
+
+// Queue_func 可靠队列的配置选项
+type Queue_func func(*queueOptions)
+
+// WithQueueVisibilityTimeout 设置可见性超时，worker 超过该时间没有心跳时其处理中的任务会被回收，默认 30 秒
+func WithQueueVisibilityTimeout(timeout time.Duration) Queue_func {
+	return func(o *queueOptions) {
+		o.visibilityTimeout = timeout
+	}
+}
+
+// WithQueueMaxAttempts 设置最大投递次数，超过后任务进入死信列表，默认 5
+func WithQueueMaxAttempts(n int) Queue_func {
+	return func(o *queueOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithQueuePopTimeout 设置 Run 中每次阻塞等待任务的时间，也决定了停止时的最长等待，默认 1 秒
+func WithQueuePopTimeout(timeout time.Duration) Queue_func {
+	return func(o *queueOptions) {
+		o.popTimeout = timeout
+	}
+}
+
+// Job 队列中的任务
+type Job struct {
+	ID string
+	// Body 任务内容
+	Body []byte
+	// Attempts 已投递次数，包括本次
+	Attempts int
+
+	raw []byte
+}
+
+// Queue 基于列表的可靠队列，任务被原子移动到 worker 的处理列表，处理成功后确认删除
+// worker 崩溃后处理中的任务会在可见性超时后重新投递，多次失败的任务进入死信列表
+// 所有 key 使用 {name} 哈希标签，集群模式下位于同一个槽
+type Queue struct {
+	commander RedisCommander
+	name      string
+	opts      queueOptions
+}
+
+// NewQueue 创建基于全局连接池的可靠队列
+func NewQueue(name string, opts ...Queue_func) *Queue {
+	initGlobalCommander()
+	return NewQueueWithCommander(globalCommander, name, opts...)
+}
+
+// NewQueueWithCommander 使用指定的命令实例创建可靠队列
+func NewQueueWithCommander(commander RedisCommander, name string, opts ...Queue_func) *Queue {
+	q := &Queue{
+		commander: commander,
+		name:      name,
+		opts: queueOptions{
+			visibilityTimeout: 30 * time.Second,
+			maxAttempts:       5,
+			popTimeout:        time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(&q.opts)
+	}
+	return q
+}
+
+func (q *Queue) key(suffix string) string {
+	return "{" + q.name + "}:" + suffix
+}
+
+func (q *Queue) processingKey(worker string) string {
+	return q.key("processing:") + worker
+}
+
+// Push 把任务放入队列，返回任务 id
+func (q *Queue) Push(ctx context.Context, body []byte) (string, error) {
+	id := randomToken()
+	raw := make([]byte, 0, jobIDLen+3+len(body))
+	raw = append(append(append(raw, id...), ":0:"...), body...)
+	_, err := commanderWithContext(q.commander, ctx).LPush(q.key("pending"), raw)
+	return id, err
+}
+
+// Pop 阻塞等待任务并原子移动到 worker 的处理列表，超时返回 ErrNil
+// 优先使用 BLMOVE（Redis 6.2+），不支持时回退到 BRPOPLPUSH
+func (q *Queue) Pop(ctx context.Context, worker string, timeout time.Duration) (*Job, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := q.Heartbeat(ctx, worker); err != nil {
+		return nil, err
+	}
+	// 阻塞命令的读超时要比 timeout 更长，否则超过连接默认读超时的等待会被中断
+	commander := commanderWithContext(q.commander, withBlockTimeout(ctx, timeout))
+	pending, processing := q.key("pending"), q.processingKey(worker)
+	reply, err := commander.Cmd("BLMOVE", pending, processing, "RIGHT", "LEFT", timeout.Seconds())
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		reply, err = commander.Cmd("BRPOPLPUSH", pending, processing, int(timeout.Seconds()+0.999))
+	}
+	raw, err := redis.Bytes(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	return parseJob(raw), nil
+}
+
+// Ack 确认任务处理完成，任务已被回收时返回 ErrJobNotFound
+func (q *Queue) Ack(ctx context.Context, worker string, job *Job) error {
+	n, err := redis.Int(commanderWithContext(q.commander, ctx).Cmd("LREM", q.processingKey(worker), 1, job.raw))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Nack 任务处理失败，放回队尾重试，达到最大投递次数时进入死信列表
+// dead 返回任务是否进入了死信列表
+func (q *Queue) Nack(ctx context.Context, worker string, job *Job) (dead bool, err error) {
+	keys := []string{q.processingKey(worker), q.key("pending"), q.key("dead")}
+	n, err := redis.Int(queueNackScript.Run(commanderWithContext(q.commander, ctx), keys, job.raw, q.opts.maxAttempts))
+	if err != nil {
+		return false, err
+	}
+	if n < 0 {
+		return false, ErrJobNotFound
+	}
+	return n == 1, nil
+}
+
+// Heartbeat 更新 worker 的心跳时间，Pop 和 Run 会自动调用
+func (q *Queue) Heartbeat(ctx context.Context, worker string) error {
+	_, err := commanderWithContext(q.commander, ctx).Cmd("ZADD", q.key("workers"), time.Now().UnixMilli(), worker)
+	return err
+}
+
+// Reap 回收心跳超过可见性超时的 worker 处理中的任务，返回回收的任务数
+func (q *Queue) Reap(ctx context.Context) (int, error) {
+	deadline := time.Now().Add(-q.opts.visibilityTimeout).UnixMilli()
+	workers, err := redis.Strings(commanderWithContext(q.commander, ctx).Cmd("ZRANGEBYSCORE", q.key("workers"), "-inf", deadline))
+	if err != nil || len(workers) == 0 {
+		return 0, err
+	}
+	// 查询后恢复心跳的 worker 由脚本再次检查跳过
+	return q.reap(ctx, deadline, workers)
+}
+
+// Requeue 立即回收指定 worker 处理中的任务，用于 worker 正常退出
+func (q *Queue) Requeue(ctx context.Context, worker string) (int, error) {
+	return q.reap(ctx, math.MaxInt64, []string{worker})
+}
+
+// reap 在脚本中回收 workers 的处理列表，processing key 由这里列出，集群模式下脚本只访问 KEYS 中的 key
+func (q *Queue) reap(ctx context.Context, deadline int64, workers []string) (int, error) {
+	keys := make([]string, 0, 3+len(workers))
+	keys = append(keys, q.key("pending"), q.key("workers"), q.key("dead"))
+	args := make([]interface{}, 0, 2+len(workers))
+	args = append(args, q.opts.maxAttempts, deadline)
+	for _, worker := range workers {
+		keys = append(keys, q.processingKey(worker))
+		args = append(args, worker)
+	}
+	return redis.Int(queueReapScript.Run(commanderWithContext(q.commander, ctx), keys, args...))
+}
+
+// Len 返回等待中的任务数
+func (q *Queue) Len(ctx context.Context) (int, error) {
+	return redis.Int(commanderWithContext(q.commander, ctx).LLen(q.key("pending")))
+}
+
+// DeadLetters 返回死信列表中的任务
+func (q *Queue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	values, err := redis.ByteSlices(commanderWithContext(q.commander, ctx).Cmd("LRANGE", q.key("dead"), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(values))
+	for _, raw := range values {
+		jobs = append(jobs, parseJob(raw))
+	}
+	return jobs, nil
+}
+
+// Run 以 worker 身份循环处理任务，handler 返回 nil 时确认，返回错误时重试或进入死信列表
+// 运行期间定期发送心跳并回收超时 worker 的任务，ctx 结束后处理完当前任务并把未处理的任务放回队列
+func (q *Queue) Run(ctx context.Context, worker string, handler func(ctx context.Context, job *Job) error) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(q.opts.visibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				bg := context.Background()
+				if err := q.Heartbeat(bg, worker); err != nil {
+					log.Printf("queue %s heartbeat err:%v", q.name, err)
+				}
+				if _, err := q.Reap(bg); err != nil {
+					log.Printf("queue %s reap err:%v", q.name, err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		// 阻塞命令不绑定 ctx，退出时没有进行中的 Pop，可以安全回收
+		if _, err := q.Requeue(context.Background(), worker); err != nil {
+			log.Printf("queue %s requeue worker %s err:%v", q.name, worker, err)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		job, err := q.Pop(context.Background(), worker, q.opts.popTimeout)
+		if err == ErrNil {
+			continue
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.opts.popTimeout):
+			}
+			continue
+		}
+		if err := handler(ctx, job); err != nil {
+			if _, err := q.Nack(context.Background(), worker, job); err != nil && err != ErrJobNotFound {
+				log.Printf("queue %s nack job %s err:%v", q.name, job.ID, err)
+			}
+			continue
+		}
+		if err := q.Ack(context.Background(), worker, job); err != nil && err != ErrJobNotFound {
+			log.Printf("queue %s ack job %s err:%v", q.name, job.ID, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// parseJob 解析列表中的任务，Attempts 为之前的投递次数加上本次
+// 格式不符时整个值作为内容，id 与脚本一致取前 32 个字节
+func parseJob(raw []byte) *Job {
+	if len(raw) > jobIDLen && raw[jobIDLen] == ':' {
+		rest := raw[jobIDLen+1:]
+		if i := bytes.IndexByte(rest, ':'); i > 0 && isDigits(rest[:i]) {
+			if n, err := strconv.Atoi(string(rest[:i])); err == nil {
+				return &Job{ID: string(raw[:jobIDLen]), Body: rest[i+1:], Attempts: n + 1, raw: raw}
+			}
+		}
+	}
+	id := raw
+	if len(id) > jobIDLen {
+		id = id[:jobIDLen]
+	}
+	return &Job{ID: string(id), Body: raw, Attempts: 1, raw: raw}
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func newTestQueue(t *testing.T, opts ...Queue_func) *Queue {
+	commander, _ := newRedisTestCommander(t)
+	q := NewQueueWithCommander(commander, "test:queue:"+t.Name(), opts...)
+	cleanup := func() {
+		for _, suffix := range []string{"pending", "workers", "dead", "processing:w1", "processing:w2"} {
+			commander.Del(q.key(suffix))
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return q
+}
+
+func TestQueue_PushPopAck(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+	id, err := q.Push(ctx, []byte("job-1"))
+	if err != nil {
+		t.Fatalf("Push err: %v", err)
+	}
+	job, err := q.Pop(ctx, "w1", time.Second)
+	if err != nil {
+		t.Fatalf("Pop err: %v", err)
+	}
+	if job.ID != id || string(job.Body) != "job-1" || job.Attempts != 1 {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if err := q.Ack(ctx, "w1", job); err != nil {
+		t.Errorf("Ack err: %v", err)
+	}
+	if err := q.Ack(ctx, "w1", job); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if _, err := q.Pop(ctx, "w1", 100*time.Millisecond); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil on empty queue, got %v", err)
+	}
+}
+
+func TestQueue_PopPastReadTimeout(t *testing.T) {
+	q := newTestQueue(t)
+	q.commander, _ = newRedisTestCommander(t, redis.DialReadTimeout(50*time.Millisecond))
+	if _, err := q.Pop(context.Background(), "w1", 300*time.Millisecond); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil after blocking past the read timeout, got %v", err)
+	}
+}
+
+func TestQueue_NackDeadLetter(t *testing.T) {
+	q := newTestQueue(t, WithQueueMaxAttempts(2))
+	ctx := context.Background()
+	q.Push(ctx, []byte("bad"))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, err := q.Pop(ctx, "w1", time.Second)
+		if err != nil || job.Attempts != attempt {
+			t.Fatalf("Expected attempt %d, got %+v %v", attempt, job, err)
+		}
+		dead, err := q.Nack(ctx, "w1", job)
+		if err != nil || dead != (attempt == 2) {
+			t.Errorf("Attempt %d: unexpected dead=%v err=%v", attempt, dead, err)
+		}
+	}
+	jobs, err := q.DeadLetters(ctx)
+	if err != nil || len(jobs) != 1 || string(jobs[0].Body) != "bad" {
+		t.Errorf("Expected job in dead letters, got %v %v", jobs, err)
+	}
+	if n, _ := q.Len(ctx); n != 0 {
+		t.Errorf("Expected empty queue, got %d", n)
+	}
+}
+
+func TestQueue_ReapDeadWorker(t *testing.T) {
+	q := newTestQueue(t, WithQueueVisibilityTimeout(50*time.Millisecond))
+	ctx := context.Background()
+	q.Push(ctx, []byte("job"))
+	job, _ := q.Pop(ctx, "w1", time.Second)
+
+	if n, err := q.Reap(ctx); err != nil || n != 0 {
+		t.Errorf("Expected live worker not to be reaped, got %d %v", n, err)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if n, err := q.Reap(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 reaped job, got %d %v", n, err)
+	}
+	if err := q.Ack(ctx, "w1", job); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound after reap, got %v", err)
+	}
+	again, err := q.Pop(ctx, "w2", time.Second)
+	if err != nil || again.ID != job.ID || again.Attempts != 2 {
+		t.Errorf("Expected redelivery with attempt 2, got %+v %v", again, err)
+	}
+}
+
+func TestQueue_Run(t *testing.T) {
+	q := newTestQueue(t, WithQueuePopTimeout(100*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, body := range []string{"a", "b", "c"} {
+		q.Push(ctx, []byte(body))
+	}
+
+	var mu sync.Mutex
+	var got []string
+	done := make(chan error)
+	go func() {
+		done <- q.Run(ctx, "w1", func(ctx context.Context, job *Job) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, string(job.Body))
+			if len(got) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+	if len(got) != 3 || got[0] != "a" {
+		t.Errorf("Expected jobs in FIFO order, got %v", got)
+	}
+}
+
+func TestQueue_RequeueDeadLetter(t *testing.T) {
+	q := newTestQueue(t, WithQueueMaxAttempts(2))
+	ctx := context.Background()
+	q.Push(ctx, []byte("crash"))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, err := q.Pop(ctx, "w1", time.Second)
+		if err != nil || job.Attempts != attempt {
+			t.Fatalf("Expected attempt %d, got %+v %v", attempt, job, err)
+		}
+		if n, err := q.Requeue(ctx, "w1"); err != nil || n != 1 {
+			t.Fatalf("Expected 1 requeued job, got %d %v", n, err)
+		}
+	}
+	if n, _ := q.Len(ctx); n != 0 {
+		t.Errorf("Expected empty queue, got %d", n)
+	}
+	jobs, err := q.DeadLetters(ctx)
+	if err != nil || len(jobs) != 1 || string(jobs[0].Body) != "crash" || jobs[0].Attempts != 2 {
+		t.Errorf("Expected job in dead letters after 2 attempts, got %+v %v", jobs, err)
+	}
+}
+
+func TestParseJob(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef"
+	job := parseJob([]byte(id + ":3:a:b"))
+	if job.ID != id || string(job.Body) != "a:b" || job.Attempts != 4 {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	job = parseJob([]byte(id + ":body"))
+	if job.ID != id || string(job.Body) != id+":body" || job.Attempts != 1 {
+		t.Errorf("Expected foreign value as body, got %+v", job)
+	}
+}
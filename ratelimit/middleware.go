@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc 从请求中提取限流 key，返回空字符串时不限流
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP 按客户端 IP 限流
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware 返回 HTTP 限流中间件，keyFunc 为 nil 时按客户端 IP 限流
+// 响应会带上 X-RateLimit-Limit/Remaining/Reset 头，被拒绝时返回 429 和 Retry-After
+// Redis 出错时放行请求，避免限流故障影响业务
+func Middleware(limiter *Limiter, limit Limit, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	if keyFunc == nil {
+		keyFunc = KeyByIP
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, err := limiter.Allow(r.Context(), key, limit)
+			if err != nil {
+				log.Printf("ratelimit key:%s err:%v", key, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Rate))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("X-RateLimit-Reset", strconv.Itoa(seconds(res.ResetAfter)))
+			if !res.Allowed {
+				if res.RetryAfter > 0 {
+					h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+				}
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds 向上取整到秒
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
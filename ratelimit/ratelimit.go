@@ -0,0 +1,207 @@
+// Package ratelimit 基于 Redis 的分布式限流，支持固定窗口、滑动日志、令牌桶和 GCRA 算法
+// 每种算法都是一个原子执行的 Lua 脚本，可用于全局、sredis、mredis 和集群模式的命令实例
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Xuzan9396/zredis"
+	"github.com/garyburd/redigo/redis"
+)
+
+// Algorithm 限流算法
+type Algorithm int
+
+const (
+	// GCRA 通用信元速率算法，请求均匀分布，支持突发，只占用一个字符串 key（默认）
+	GCRA Algorithm = iota
+	// FixedWindow 固定窗口计数，实现最简单，窗口边界可能出现两倍突发
+	FixedWindow
+	// SlidingLog 滑动日志，使用 ZSET 记录窗口内的每次请求，最精确但内存占用与请求数成正比
+	SlidingLog
+	// TokenBucket 令牌桶，按速率补充令牌，桶容量为突发上限
+	TokenBucket
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case GCRA:
+		return "gcra"
+	case FixedWindow:
+		return "fixed_window"
+	case SlidingLog:
+		return "sliding_log"
+	case TokenBucket:
+		return "token_bucket"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// ErrInvalidLimit 限流规则的速率或周期不大于0
+var ErrInvalidLimit = errors.New("ratelimit: rate and period must be positive")
+
+// Limit 限流规则，Period 内最多 Rate 次请求，Burst 为令牌桶和 GCRA 的突发上限，不设置时等于 Rate
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// PerSecond 每秒 rate 次
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second, Burst: rate}
+}
+
+// PerMinute 每分钟 rate 次
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute, Burst: rate}
+}
+
+// PerHour 每小时 rate 次
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour, Burst: rate}
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// Result 限流结果
+type Result struct {
+	Limit Limit
+	// Allowed 本次请求是否允许
+	Allowed bool
+	// Remaining 剩余可用次数
+	Remaining int
+	// RetryAfter 被拒绝时需要等待的时间，允许时为 0，小于 0 表示本次请求的数量超过上限，永远无法满足
+	RetryAfter time.Duration
+	// ResetAfter 限额完全恢复需要的时间
+	ResetAfter time.Duration
+}
+
+// Limiter 分布式限流器
+type Limiter struct {
+	commander zredis.RedisCommander
+	algorithm Algorithm
+	prefix    string
+}
+
+// Limiter_func 限流器的配置选项
+type Limiter_func func(*Limiter)
+
+// WithAlgorithm 设置限流算法，默认 GCRA
+func WithAlgorithm(algorithm Algorithm) Limiter_func {
+	return func(l *Limiter) {
+		l.algorithm = algorithm
+	}
+}
+
+// WithPrefix 设置限流 key 的前缀，默认 "ratelimit:"
+func WithPrefix(prefix string) Limiter_func {
+	return func(l *Limiter) {
+		l.prefix = prefix
+	}
+}
+
+// New 使用指定的命令实例创建限流器
+//
+//	zredis.GetCommander()            // 全局模式
+//	sredisPool.GetCommander()        // 单实例模式
+//	mredis.GetCommander("name")      // 多实例模式
+func New(commander zredis.RedisCommander, opts ...Limiter_func) *Limiter {
+	l := &Limiter{
+		commander: commander,
+		algorithm: GCRA,
+		prefix:    "ratelimit:",
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Scripts 返回限流使用的 Lua 脚本，可以通过连接池的 WithScripts 选项预加载
+func Scripts() []*zredis.Script {
+	return []*zredis.Script{fixedWindowScript, slidingLogScript, tokenBucketScript, gcraScript}
+}
+
+// Allow 判断一次请求是否允许
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return l.AllowN(ctx, key, limit, 1)
+}
+
+// AllowN 判断 n 次请求是否允许，允许时一次性扣除
+func (l *Limiter) AllowN(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return Result{}, ErrInvalidLimit
+	}
+	period := limit.Period.Milliseconds()
+	keys := []string{l.prefix + key}
+
+	var script *zredis.Script
+	var args []interface{}
+	switch l.algorithm {
+	case FixedWindow:
+		script, args = fixedWindowScript, []interface{}{limit.Rate, period, n}
+	case SlidingLog:
+		script, args = slidingLogScript, []interface{}{limit.Rate, period, n, randomMember()}
+	case TokenBucket:
+		script, args = tokenBucketScript, []interface{}{limit.Rate, period, limit.burst(), n}
+	case GCRA:
+		script, args = gcraScript, []interface{}{limit.Rate, period, limit.burst(), n}
+	default:
+		return Result{}, fmt.Errorf("ratelimit: unknown algorithm %v", l.algorithm)
+	}
+
+	values, err := redis.Int64s(script.Run(l.withContext(ctx), keys, args...))
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected script reply %v", values)
+	}
+	res := Result{
+		Limit:      limit,
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration(values[2]) * time.Millisecond
+		if values[2] < 0 {
+			res.RetryAfter = -1
+		}
+	}
+	return res, nil
+}
+
+// Reset 清除 key 的限流状态
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	_, err := l.withContext(ctx).Del(l.prefix + key)
+	return err
+}
+
+func (l *Limiter) withContext(ctx context.Context) zredis.RedisCommander {
+	if c, ok := l.commander.(zredis.RedisCommanderCtx); ok && ctx != nil {
+		return c.WithContext(ctx)
+	}
+	return l.commander
+}
+
+// randomMember 滑动日志中每次请求的唯一成员前缀
+func randomMember() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Xuzan9396/zredis"
+	"github.com/Xuzan9396/zredis/ratelimit"
+	"github.com/Xuzan9396/zredis/sredis"
+)
+
+func newLimiterCommander(t *testing.T) zredis.RedisCommander {
+	pool, err := sredis.Conn("127.0.0.1:6379", "27252725", 0)
+	if err != nil {
+		t.Skip("redis not available")
+	}
+	return pool.GetCommander()
+}
+
+func TestLimiter_Algorithms(t *testing.T) {
+	commander := newLimiterCommander(t)
+	ctx := context.Background()
+	for _, algorithm := range []ratelimit.Algorithm{ratelimit.FixedWindow, ratelimit.SlidingLog, ratelimit.TokenBucket, ratelimit.GCRA} {
+		limiter := ratelimit.New(commander, ratelimit.WithAlgorithm(algorithm), ratelimit.WithPrefix("test:ratelimit:"))
+		limit := ratelimit.PerMinute(3)
+		key := algorithm.String()
+		limiter.Reset(ctx, key)
+
+		for i := 0; i < 3; i++ {
+			res, err := limiter.Allow(ctx, key, limit)
+			if err != nil {
+				t.Fatalf("%s: Allow err: %v", algorithm, err)
+			}
+			if !res.Allowed || res.Remaining != 2-i {
+				t.Errorf("%s: request %d expected allowed with %d remaining, got %+v", algorithm, i, 2-i, res)
+			}
+		}
+		res, err := limiter.Allow(ctx, key, limit)
+		if err != nil || res.Allowed || res.Remaining != 0 {
+			t.Errorf("%s: expected rejection, got %+v %v", algorithm, res, err)
+		}
+		if res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+			t.Errorf("%s: unexpected RetryAfter %v", algorithm, res.RetryAfter)
+		}
+
+		// 超过上限的批量请求永远无法满足
+		res, err = limiter.AllowN(ctx, key+":big", limit, 4)
+		if err != nil || res.Allowed || res.RetryAfter >= 0 {
+			t.Errorf("%s: expected never-satisfiable result, got %+v %v", algorithm, res, err)
+		}
+		limiter.Reset(ctx, key)
+		limiter.Reset(ctx, key+":big")
+	}
+}
+
+func TestLimiter_InvalidLimit(t *testing.T) {
+	limiter := ratelimit.New(nil)
+	if _, err := limiter.Allow(context.Background(), "k", ratelimit.Limit{}); err != ratelimit.ErrInvalidLimit {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	commander := newLimiterCommander(t)
+	limiter := ratelimit.New(commander, ratelimit.WithPrefix("test:ratelimit:http:"))
+	limiter.Reset(context.Background(), "client")
+	handler := ratelimit.Middleware(limiter, ratelimit.PerMinute(1), func(r *http.Request) string {
+		return "client"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected first request to pass, got %d %v", rec.Code, rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	limiter.Reset(context.Background(), "client")
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import "github.com/Xuzan9396/zredis"
+
+// 所有脚本使用 Redis 服务端时间，返回 {是否允许, 剩余次数, 重试等待毫秒(-1 表示无需等待或永远无法满足), 完全恢复毫秒}
+// Redis 5 以下需要 replicate_commands 才能在 TIME 之后执行写命令
+
+// fixedWindowScript 固定窗口计数
+// ARGV: limit, period(ms), cost
+var fixedWindowScript = zredis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	ttl = period
+end
+if cost > limit then
+	return {0, math.max(limit - current, 0), -1, ttl}
+end
+if current + cost > limit then
+	return {0, math.max(limit - current, 0), ttl, ttl}
+end
+
+current = redis.call("INCRBY", KEYS[1], cost)
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], period)
+	ttl = period
+end
+return {1, limit - current, -1, ttl}
+`)
+
+// slidingLogScript 滑动日志，ZSET 中保存窗口内每次请求的时间
+// ARGV: limit, period(ms), cost, member 前缀
+var slidingLogScript = zredis.NewScript(`
+pcall(redis.replicate_commands)
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - period)
+local count = redis.call("ZCARD", KEYS[1])
+local reset = 0
+if count > 0 then
+	local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	reset = tonumber(newest[2]) + period - now
+end
+
+if cost > limit then
+	return {0, limit - count, -1, reset}
+end
+if count + cost > limit then
+	-- 需要等到第 count+cost-limit 个最早的请求移出窗口
+	local oldest = redis.call("ZRANGE", KEYS[1], count + cost - limit - 1, count + cost - limit - 1, "WITHSCORES")
+	return {0, limit - count, tonumber(oldest[2]) + period - now, reset}
+end
+
+for i = 1, cost do
+	redis.call("ZADD", KEYS[1], now, ARGV[4] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], period)
+return {1, limit - count - cost, -1, period}
+`)
+
+// tokenBucketScript 令牌桶，哈希中保存剩余令牌和上次更新时间
+// ARGV: limit, period(ms), burst, cost
+var tokenBucketScript = zredis.NewScript(`
+pcall(redis.replicate_commands)
+local rate = tonumber(ARGV[1]) / tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + math.max(now - ts, 0) * rate)
+
+local allowed = 0
+local retry = -1
+if cost <= tokens then
+	allowed = 1
+	tokens = tokens - cost
+elseif cost <= capacity then
+	retry = math.ceil((cost - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// gcraScript 通用信元速率算法，只保存理论到达时间（TAT）
+// ARGV: limit, period(ms), burst, cost
+var gcraScript = zredis.NewScript(`
+pcall(redis.replicate_commands)
+local emission = tonumber(ARGV[2]) / tonumber(ARGV[1])
+local burst_offset = emission * tonumber(ARGV[3])
+local increment = emission * tonumber(ARGV[4])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+tat = math.max(tat, now)
+
+local new_tat = tat + increment
+local diff = now - (new_tat - burst_offset)
+if diff < 0 then
+	local retry = -1
+	if increment <= burst_offset then
+		retry = math.ceil(-diff)
+	end
+	local remaining = math.floor((now - (tat - burst_offset)) / emission)
+	return {0, math.max(remaining, 0), retry, math.ceil(tat - now)}
+end
+
+local reset = math.ceil(new_tat - now)
+redis.call("SET", KEYS[1], tostring(new_tat), "PX", math.max(reset, 1))
+return {1, math.floor(diff / emission), -1, reset}
+`)
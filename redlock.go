@@ -0,0 +1,168 @@
+package zredis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Redlock 在多个独立的 Redis 节点上加锁，超过半数节点成功且扣除耗时和时钟漂移后仍有有效期时才算获取成功
+type Redlock struct {
+	nodes []RedisCommander
+	opts  []Lock_func
+}
+
+// NewRedlock 使用多个独立节点的命令实例创建 Redlock，节点之间不能是主从关系
+// 不支持 WithLockWatchdog，需要时通过 Extend 手动续期
+func NewRedlock(nodes []RedisCommander, opts ...Lock_func) *Redlock {
+	return &Redlock{nodes: nodes, opts: opts}
+}
+
+// Quorum 返回获取锁需要成功的节点数
+func (r *Redlock) Quorum() int {
+	return len(r.nodes)/2 + 1
+}
+
+// TryLock 尝试获取一次锁，未达到多数节点时释放已获取的节点并返回 ErrLockNotObtained
+func (r *Redlock) TryLock(ctx context.Context, key string, opts ...Lock_func) (*RedlockLock, error) {
+	o := newLockOptions(append(r.opts[:len(r.opts):len(r.opts)], opts...)...)
+	return r.tryLock(ctx, key, o)
+}
+
+// Lock 阻塞获取锁，按指数退避重试直到成功或 ctx 结束
+func (r *Redlock) Lock(ctx context.Context, key string, opts ...Lock_func) (*RedlockLock, error) {
+	o := newLockOptions(append(r.opts[:len(r.opts):len(r.opts)], opts...)...)
+	return retryLock(ctx, o, func() (*RedlockLock, error) {
+		return r.tryLock(ctx, key, o)
+	})
+}
+
+func (r *Redlock) tryLock(ctx context.Context, key string, o lockOptions) (*RedlockLock, error) {
+	token := o.token
+	if token == "" {
+		token = randomToken()
+	}
+	lock := &RedlockLock{redlock: r, key: key, token: token, ttl: o.ttl, opts: o}
+
+	start := time.Now()
+	n := lock.eachNode(ctx, func(node RedisCommander) (bool, error) {
+		reply, err := node.Cmd("SET", key, token, "NX", "PX", durationMs(o.ttl))
+		return reply != nil, err
+	})
+	if !lock.setValidity(start, n) {
+		lock.releaseAll(ctx)
+		return nil, ErrLockNotObtained
+	}
+	return lock, nil
+}
+
+// RedlockLock 通过 Redlock 获取的锁
+type RedlockLock struct {
+	redlock *Redlock
+	key     string
+	token   string
+	ttl     time.Duration
+	opts    lockOptions
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// Key 返回锁的 key
+func (lk *RedlockLock) Key() string {
+	return lk.key
+}
+
+// Token 返回锁的令牌
+func (lk *RedlockLock) Token() string {
+	return lk.token
+}
+
+// Until 返回锁的有效截止时间，之后不再保证互斥
+func (lk *RedlockLock) Until() time.Time {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	return lk.until
+}
+
+// Validity 返回锁的剩余有效时间
+func (lk *RedlockLock) Validity() time.Duration {
+	if d := time.Until(lk.Until()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Extend 在所有节点上续期，超过半数节点成功时更新有效期，否则返回 ErrLockNotHeld
+func (lk *RedlockLock) Extend(ctx context.Context, ttl time.Duration) error {
+	start := time.Now()
+	n := lk.eachNode(ctx, func(node RedisCommander) (bool, error) {
+		n, err := redis.Int(node.LuaScript(lockExtendScript, lk.key, lk.token, durationMs(ttl)))
+		return n == 1, err
+	})
+	lk.mu.Lock()
+	lk.ttl = ttl
+	lk.mu.Unlock()
+	if !lk.setValidity(start, n) {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release 在所有节点上释放锁，包括加锁时没有回复的节点，没有任何节点持有时返回 ErrLockNotHeld
+func (lk *RedlockLock) Release(ctx context.Context) error {
+	lk.mu.Lock()
+	lk.until = time.Time{}
+	lk.mu.Unlock()
+	if lk.releaseAll(ctx) == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (lk *RedlockLock) releaseAll(ctx context.Context) int {
+	return lk.eachNode(ctx, func(node RedisCommander) (bool, error) {
+		n, err := redis.Int(node.LuaScript(lockReleaseScript, lk.key, lk.token))
+		return n == 1, err
+	})
+}
+
+// setValidity 达到多数节点时按 ttl - 耗时 - 漂移 计算有效期
+func (lk *RedlockLock) setValidity(start time.Time, n int) bool {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	drift := time.Duration(float64(lk.ttl)*lk.opts.driftFactor) + 2*time.Millisecond
+	validity := lk.ttl - time.Since(start) - drift
+	if n < lk.redlock.Quorum() || validity <= 0 {
+		lk.until = time.Time{}
+		return false
+	}
+	lk.until = start.Add(lk.ttl - drift)
+	return true
+}
+
+// eachNode 并发在所有节点上执行 fn，每个节点单独超时，返回成功的节点数
+func (lk *RedlockLock) eachNode(ctx context.Context, fn func(node RedisCommander) (bool, error)) int {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		n  int
+	)
+	for _, node := range lk.redlock.nodes {
+		wg.Add(1)
+		go func(node RedisCommander) {
+			defer wg.Done()
+			nodeCtx, cancel := context.WithTimeout(ctx, lk.opts.nodeTimeout)
+			defer cancel()
+			if ok, err := fn(commanderWithContext(node, nodeCtx)); ok && err == nil {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		}(node)
+	}
+	wg.Wait()
+	return n
+}
@@ -0,0 +1,87 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newRedlockNodes(n int) ([]*memStore, []RedisCommander) {
+	stores := make([]*memStore, n)
+	nodes := make([]RedisCommander, n)
+	for i := range stores {
+		stores[i], nodes[i] = newMemCommander()
+	}
+	return stores, nodes
+}
+
+func TestRedlock_Quorum(t *testing.T) {
+	stores, nodes := newRedlockNodes(3)
+	redlock := NewRedlock(nodes, WithLockTTL(time.Second))
+	ctx := context.Background()
+	if redlock.Quorum() != 2 {
+		t.Errorf("Expected quorum 2, got %d", redlock.Quorum())
+	}
+
+	// 一个节点被占用仍能达到多数
+	stores[0].set("redlock:a", []byte("other"))
+	lock, err := redlock.TryLock(ctx, "redlock:a")
+	if err != nil {
+		t.Fatalf("TryLock err: %v", err)
+	}
+	if v := lock.Validity(); v <= 0 || v > time.Second {
+		t.Errorf("Unexpected validity %v", v)
+	}
+	for i, store := range stores[1:] {
+		if raw, _ := store.get("redlock:a"); string(raw) != lock.Token() {
+			t.Errorf("Expected node %d to hold the lock, got %s", i+1, raw)
+		}
+	}
+	if err := lock.Extend(ctx, 2*time.Second); err != nil || lock.Validity() <= time.Second {
+		t.Errorf("Expected extended validity, got %v %v", lock.Validity(), err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Release err: %v", err)
+	}
+	if raw, _ := stores[0].get("redlock:a"); string(raw) != "other" {
+		t.Errorf("Expected other's lock to remain, got %s", raw)
+	}
+	for _, store := range stores[1:] {
+		if _, ok := store.get("redlock:a"); ok {
+			t.Error("Expected lock to be released on all nodes")
+		}
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Expected ErrLockNotHeld, got %v", err)
+	}
+}
+
+func TestRedlock_NoQuorum(t *testing.T) {
+	stores, nodes := newRedlockNodes(3)
+	redlock := NewRedlock(nodes, WithLockRetry(5*time.Millisecond, 10*time.Millisecond))
+	stores[0].set("redlock:b", []byte("other"))
+	stores[1].set("redlock:b", []byte("other"))
+
+	if _, err := redlock.TryLock(context.Background(), "redlock:b"); !errors.Is(err, ErrLockNotObtained) {
+		t.Errorf("Expected ErrLockNotObtained, got %v", err)
+	}
+	// 未达到多数时释放已获取的节点
+	if _, ok := stores[2].get("redlock:b"); ok {
+		t.Error("Expected partial lock to be released")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := redlock.Lock(ctx, "redlock:b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRedlock_ValidityConsumedByDrift(t *testing.T) {
+	_, nodes := newRedlockNodes(3)
+	redlock := NewRedlock(nodes, WithLockTTL(10*time.Millisecond), WithLockDriftFactor(1))
+	if _, err := redlock.TryLock(context.Background(), "redlock:c"); !errors.Is(err, ErrLockNotObtained) {
+		t.Errorf("Expected ErrLockNotObtained when drift exceeds ttl, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package zredis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// HashField 哈希字段及值
+type HashField struct {
+	Field string
+	Value string
+}
+
+type scanOptions struct {
+	match string
+	count int64
+	typ   string
+}
+
+// Scan_func SCAN 系列迭代器的配置选项
+type Scan_func func(*scanOptions)
+
+// WithScanMatch 只返回匹配 pattern 的元素
+func WithScanMatch(pattern string) Scan_func {
+	return func(o *scanOptions) {
+		o.match = pattern
+	}
+}
+
+// WithScanCount 设置每次迭代的 COUNT 提示，服务端返回的数量可能不同
+func WithScanCount(count int64) Scan_func {
+	return func(o *scanOptions) {
+		o.count = count
+	}
+}
+
+// WithScanType 只返回指定类型的 key，如 "string"、"hash"，仅用于 SCAN（Redis 6.0+）
+func WithScanType(typ string) Scan_func {
+	return func(o *scanOptions) {
+		o.typ = typ
+	}
+}
+
+// Scanner SCAN、SSCAN、HSCAN、ZSCAN 的迭代器，按需逐批获取，不会像 KEYS 一样阻塞服务端
+// 迭代期间被修改的元素可能重复或遗漏，与 SCAN 的保证一致
+//
+//	it := zredis.Scan(ctx, commander, zredis.WithScanMatch("user:*"))
+//	for it.Next() {
+//		fmt.Println(it.Val())
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Scanner[T any] struct {
+	ctx       context.Context
+	commander RedisCommander
+	cmd       string
+	key       string
+	opts      scanOptions
+	parse     func(values []string) []T
+	// nodes 集群模式下当前节点遍历结束后依次遍历的其余主节点
+	nodes []RedisCommander
+
+	cursor string
+	page   []T
+	val    T
+	err    error
+}
+
+// Scan 创建遍历所有 key 的迭代器，集群模式的命令实例依次遍历每个主节点
+func Scan(ctx context.Context, commander RedisCommander, opts ...Scan_func) *Scanner[string] {
+	s := newScanner(ctx, commander, "SCAN", "", parseScanStrings, opts)
+	if cc, ok := s.commander.(*clusterCommands); ok {
+		for _, addr := range cc.cluster.Masters() {
+			s.nodes = append(s.nodes, cc.cluster.nodeCommander(s.ctx, addr))
+		}
+		if len(s.nodes) > 0 {
+			s.commander, s.nodes = s.nodes[0], s.nodes[1:]
+		}
+	}
+	return s
+}
+
+// SScan 创建遍历集合成员的迭代器
+func SScan(ctx context.Context, commander RedisCommander, key string, opts ...Scan_func) *Scanner[string] {
+	return newScanner(ctx, commander, "SSCAN", key, parseScanStrings, opts)
+}
+
+// HScan 创建遍历哈希字段的迭代器
+func HScan(ctx context.Context, commander RedisCommander, key string, opts ...Scan_func) *Scanner[HashField] {
+	return newScanner(ctx, commander, "HSCAN", key, parseScanHash, opts)
+}
+
+// ZScan 创建遍历有序集合成员及分数的迭代器
+func ZScan(ctx context.Context, commander RedisCommander, key string, opts ...Scan_func) *Scanner[Z] {
+	return newScanner(ctx, commander, "ZSCAN", key, parseScanZ, opts)
+}
+
+func newScanner[T any](ctx context.Context, commander RedisCommander, cmd, key string, parse func([]string) []T, opts []Scan_func) *Scanner[T] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &Scanner[T]{
+		ctx:       ctx,
+		commander: commanderWithContext(commander, ctx),
+		cmd:       cmd,
+		key:       key,
+		parse:     parse,
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+// Next 移动到下一个元素，遍历结束、出错或 ctx 结束时返回 false
+func (s *Scanner[T]) Next() bool {
+	for len(s.page) == 0 {
+		if s.err != nil {
+			return false
+		}
+		if s.cursor == "0" {
+			if len(s.nodes) == 0 {
+				return false
+			}
+			s.commander, s.nodes, s.cursor = s.nodes[0], s.nodes[1:], ""
+		}
+		if s.err = s.ctx.Err(); s.err != nil {
+			return false
+		}
+		s.fetch()
+	}
+	s.val, s.page = s.page[0], s.page[1:]
+	return true
+}
+
+// Val 返回当前元素
+func (s *Scanner[T]) Val() T {
+	return s.val
+}
+
+// Err 返回遍历过程中的错误，包括 ctx 的取消
+func (s *Scanner[T]) Err() error {
+	return s.err
+}
+
+func (s *Scanner[T]) fetch() {
+	cursor := s.cursor
+	if cursor == "" {
+		cursor = "0"
+	}
+	args := make([]interface{}, 0, 8)
+	if s.cmd != "SCAN" {
+		args = append(args, s.key)
+	}
+	args = append(args, cursor)
+	if s.opts.match != "" {
+		args = append(args, "MATCH", s.opts.match)
+	}
+	if s.opts.count > 0 {
+		args = append(args, "COUNT", s.opts.count)
+	}
+	if s.opts.typ != "" && s.cmd == "SCAN" {
+		args = append(args, "TYPE", s.opts.typ)
+	}
+	values, err := redis.Values(s.commander.Cmd(s.cmd, args...))
+	if err != nil {
+		s.err = err
+		return
+	}
+	if len(values) != 2 {
+		s.err = fmt.Errorf("zredis: unexpected %s reply %v", s.cmd, values)
+		return
+	}
+	// 游标解析失败时无法继续，也不能当作遍历结束
+	if cursor, err = redis.String(values[0], nil); err != nil || cursor == "" {
+		s.err = fmt.Errorf("zredis: unexpected %s cursor %v", s.cmd, values[0])
+		return
+	}
+	s.cursor = cursor
+	items, err := redis.Strings(values[1], nil)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.page = s.parse(items)
+}
+
+func parseScanStrings(values []string) []string {
+	return values
+}
+
+func parseScanHash(values []string) []HashField {
+	fields := make([]HashField, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields = append(fields, HashField{Field: values[i], Value: values[i+1]})
+	}
+	return fields
+}
+
+func parseScanZ(values []string) []Z {
+	members := make([]Z, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		score, _ := redis.Float64([]byte(values[i+1]), nil)
+		members = append(members, Z{Member: values[i], Score: score})
+	}
+	return members
+}
@@ -0,0 +1,23 @@
+//go:build go1.23
+
+package zredis
+
+import "iter"
+
+// All 返回可用于 range 的迭代序列，遍历结束后通过 Err 检查错误
+//
+//	it := zredis.Scan(ctx, commander, zredis.WithScanMatch("user:*"))
+//	for key := range it.All() {
+//		fmt.Println(key)
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+func (s *Scanner[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for s.Next() {
+			if !yield(s.Val()) {
+				return
+			}
+		}
+	}
+}
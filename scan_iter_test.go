@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package zredis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScanner_All(t *testing.T) {
+	commander := newScanTestData(t)
+	it := SScan(context.Background(), commander, "test:scan:set")
+	seen := map[string]bool{}
+	for member := range it.All() {
+		seen[member] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Scan err: %v", err)
+	}
+	if len(seen) != 3 || !seen["m1"] || !seen["x1"] {
+		t.Errorf("Unexpected members %v", seen)
+	}
+
+	n := 0
+	for range Scan(context.Background(), commander, WithScanMatch("test:scan:*")).All() {
+		if n++; n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("Expected early break after 2 keys, got %d", n)
+	}
+}
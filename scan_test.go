@@ -0,0 +1,115 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func newScanTestData(t *testing.T) RedisCommanderCtx {
+	commander, _ := newRedisTestCommander(t)
+	keys := []string{"test:scan:a", "test:scan:b", "test:scan:c", "test:scan:set", "test:scan:hash", "test:scan:zset"}
+	cleanup := func() {
+		for _, key := range keys {
+			commander.Del(key)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	for _, key := range keys[:3] {
+		commander.Set(key, "v")
+	}
+	for _, m := range []string{"m1", "m2", "x1"} {
+		commander.SAdd("test:scan:set", m)
+	}
+	commander.Hset("test:scan:hash", "f1", "v1")
+	commander.Hset("test:scan:hash", "f2", "v2")
+	commander.ZAdd("test:scan:zset", 1.5, "z1")
+	commander.ZAdd("test:scan:zset", 2, "z2")
+	return commander
+}
+
+func collect[T any](t *testing.T, it *Scanner[T]) []T {
+	t.Helper()
+	var values []T
+	for it.Next() {
+		values = append(values, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Scan err: %v", err)
+	}
+	return values
+}
+
+func TestScan(t *testing.T) {
+	commander := newScanTestData(t)
+	ctx := context.Background()
+
+	keys := collect(t, Scan(ctx, commander, WithScanMatch("test:scan:?"), WithScanCount(2)))
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "test:scan:a" || keys[2] != "test:scan:c" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	keys = collect(t, Scan(ctx, commander, WithScanMatch("test:scan:*"), WithScanType("hash")))
+	if len(keys) != 1 || keys[0] != "test:scan:hash" {
+		t.Errorf("Expected only the hash key, got %v", keys)
+	}
+
+	members := collect(t, SScan(ctx, commander, "test:scan:set", WithScanMatch("m*")))
+	sort.Strings(members)
+	if len(members) != 2 || members[0] != "m1" || members[1] != "m2" {
+		t.Errorf("Unexpected set members %v", members)
+	}
+
+	fields := collect(t, HScan(ctx, commander, "test:scan:hash"))
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	if len(fields) != 2 || fields[0] != (HashField{"f1", "v1"}) || fields[1] != (HashField{"f2", "v2"}) {
+		t.Errorf("Unexpected hash fields %v", fields)
+	}
+
+	zs := collect(t, ZScan(ctx, commander, "test:scan:zset"))
+	sort.Slice(zs, func(i, j int) bool { return zs[i].Member < zs[j].Member })
+	if len(zs) != 2 || zs[0] != (Z{"z1", 1.5}) || zs[1] != (Z{"z2", 2}) {
+		t.Errorf("Unexpected zset members %v", zs)
+	}
+}
+
+func TestScan_Context(t *testing.T) {
+	commander := newScanTestData(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it := Scan(ctx, commander, WithScanMatch("test:scan:*"))
+	if it.Next() {
+		t.Error("Expected Next to return false after cancel")
+	}
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", it.Err())
+	}
+}
+
+func TestScan_BadCursor(t *testing.T) {
+	commander := NewRedisCommandsCtx(func(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+		return []interface{}{int64(5), []interface{}{[]byte("k")}}, nil
+	}, nil)
+	// nil ctx 按 context.Background() 处理
+	it := Scan(nil, commander)
+	if it.Next() {
+		t.Error("Expected Next to return false on a malformed cursor")
+	}
+	if it.Err() == nil {
+		t.Error("Expected malformed cursor error")
+	}
+}
+
+func TestDelPattern_Scan(t *testing.T) {
+	commander := newScanTestData(t)
+	if err := commander.DelPattern("test:scan:?"); err != nil {
+		t.Fatalf("DelPattern err: %v", err)
+	}
+	keys := collect(t, Scan(context.Background(), commander, WithScanMatch("test:scan:*")))
+	if len(keys) != 3 {
+		t.Errorf("Expected only set, hash and zset to remain, got %v", keys)
+	}
+}
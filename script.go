@@ -0,0 +1,192 @@
+package zredis
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Script Lua脚本，通过 EVALSHA 执行，服务端未缓存脚本时自动回退到 EVAL
+// KEYS 数量不固定，每次执行时传入
+type Script struct {
+	src  string
+	hash string
+}
+
+// NewScript 创建Lua脚本
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Hash 返回脚本的SHA1
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Src 返回脚本源码
+func (s *Script) Src() string {
+	return s.src
+}
+
+func (s *Script) args(spec string, keys []string, args []interface{}) []interface{} {
+	res := make([]interface{}, 0, 2+len(keys)+len(args))
+	res = append(res, spec, len(keys))
+	for _, key := range keys {
+		res = append(res, key)
+	}
+	return append(res, args...)
+}
+
+// commandQueuer 只入队命令、由 Exec 统一返回结果的命令实例，如 Pipeline 和 Tx
+type commandQueuer interface {
+	queuesCommands() bool
+}
+
+// Run 使用命令实例执行脚本，适用于全局、单实例和多实例模式的 RedisCommander
+// 在 Pipeline 或 Tx 中入队时拿不到 NOSCRIPT 错误无法回退，直接入队 EVAL
+func (s *Script) Run(commander RedisCommander, keys []string, args ...interface{}) (interface{}, error) {
+	if q, ok := commander.(commandQueuer); ok && q.queuesCommands() {
+		return commander.Cmd("EVAL", s.args(s.src, keys, args)...)
+	}
+	res, err := commander.Cmd("EVALSHA", s.args(s.hash, keys, args)...)
+	if isNoScript(err) {
+		return commander.Cmd("EVAL", s.args(s.src, keys, args)...)
+	}
+	return res, err
+}
+
+// Do 在指定连接上执行脚本
+func (s *Script) Do(c redis.Conn, keys []string, args ...interface{}) (interface{}, error) {
+	res, err := c.Do("EVALSHA", s.args(s.hash, keys, args)...)
+	if isNoScript(err) {
+		return c.Do("EVAL", s.args(s.src, keys, args)...)
+	}
+	return res, err
+}
+
+// Load 使用 SCRIPT LOAD 把脚本预加载到服务端
+func (s *Script) Load(commander RedisCommander) error {
+	_, err := commander.Cmd("SCRIPT", "LOAD", s.src)
+	return err
+}
+
+// LoadConn 在指定连接上使用 SCRIPT LOAD 预加载脚本
+func (s *Script) LoadConn(c redis.Conn) error {
+	_, err := c.Do("SCRIPT", "LOAD", s.src)
+	return err
+}
+
+func isNoScript(err error) bool {
+	e, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(e), "NOSCRIPT ")
+}
+
+// ScriptRegistry 脚本注册表，按名称管理可复用的脚本
+type ScriptRegistry struct {
+	mu      sync.RWMutex
+	scripts map[string]*Script
+}
+
+// NewScriptRegistry 创建脚本注册表
+func NewScriptRegistry() *ScriptRegistry {
+	return &ScriptRegistry{scripts: make(map[string]*Script)}
+}
+
+// Register 注册脚本，同名脚本会被覆盖
+func (r *ScriptRegistry) Register(name, src string) *Script {
+	s := NewScript(src)
+	r.mu.Lock()
+	r.scripts[name] = s
+	r.mu.Unlock()
+	return s
+}
+
+// Get 获取指定名称的脚本
+func (r *ScriptRegistry) Get(name string) (*Script, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.scripts[name]
+	return s, ok
+}
+
+// Scripts 返回所有已注册的脚本，可配合 WithScripts 在连接时预加载
+func (r *ScriptRegistry) Scripts() []*Script {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	scripts := make([]*Script, 0, len(r.scripts))
+	for _, s := range r.scripts {
+		scripts = append(scripts, s)
+	}
+	return scripts
+}
+
+// Run 执行指定名称的脚本
+func (r *ScriptRegistry) Run(commander RedisCommander, name string, keys []string, args ...interface{}) (interface{}, error) {
+	s, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("zredis: script not registered: %s", name)
+	}
+	return s.Run(commander, keys, args...)
+}
+
+// Load 使用 SCRIPT LOAD 预加载所有已注册的脚本
+func (r *ScriptRegistry) Load(commander RedisCommander) error {
+	for _, s := range r.Scripts() {
+		if err := s.Load(commander); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxCachedScripts CachedScript 最多缓存的脚本数量，超过后淘汰最久未使用的脚本
+const maxCachedScripts = 256
+
+// scriptCache 按源码缓存脚本的 LRU，防止动态拼接的脚本无限增长
+type scriptCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // 元素为 *Script，最近使用的在前
+	items map[string]*list.Element
+}
+
+func newScriptCache(size int) *scriptCache {
+	return &scriptCache{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *scriptCache) get(src string) *Script {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[src]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*Script)
+	}
+	s := NewScript(src)
+	c.items[src] = c.ll.PushFront(s)
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*Script).src)
+	}
+	return s
+}
+
+func (c *scriptCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+var cachedScripts = newScriptCache(maxCachedScripts)
+
+// CachedScript 返回源码对应的共享脚本实例，避免每次执行都重新计算SHA1
+// 最多缓存 maxCachedScripts 个脚本，动态拼接的脚本建议直接使用 NewScript
+func CachedScript(src string) *Script {
+	return cachedScripts.get(src)
+}
@@ -0,0 +1,124 @@
+package zredis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 模拟服务端脚本缓存
+type scriptExecutor struct {
+	loaded   map[string]bool
+	commands []string
+	lastArgs []interface{}
+}
+
+func (e *scriptExecutor) execute(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	e.commands = append(e.commands, cmdStr)
+	e.lastArgs = keysAndArgs
+	switch cmdStr {
+	case "EVALSHA":
+		if !e.loaded[keysAndArgs[0].(string)] {
+			return nil, redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return int64(1), nil
+	case "EVAL":
+		return int64(1), nil
+	case "SCRIPT":
+		e.loaded[NewScript(keysAndArgs[1].(string)).Hash()] = true
+		return "OK", nil
+	}
+	return nil, nil
+}
+
+func newScriptCommander() (*scriptExecutor, RedisCommander) {
+	e := &scriptExecutor{loaded: make(map[string]bool)}
+	return e, NewRedisCommands(e.execute, nil)
+}
+
+func TestScript_RunFallback(t *testing.T) {
+	e, commander := newScriptCommander()
+	s := NewScript("return redis.call('HGET', KEYS[1], 'coin') + redis.call('HGET', KEYS[2], 'coin')")
+	res, err := s.Run(commander, []string{"test:hash1", "test:hash2"}, 2)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if res != int64(1) {
+		t.Errorf("Expected 1, got %v", res)
+	}
+	if len(e.commands) != 2 || e.commands[0] != "EVALSHA" || e.commands[1] != "EVAL" {
+		t.Errorf("Expected EVALSHA then EVAL, got %v", e.commands)
+	}
+	if e.lastArgs[1] != 2 || e.lastArgs[2] != "test:hash1" || e.lastArgs[3] != "test:hash2" || e.lastArgs[4] != 2 {
+		t.Errorf("Expected numkeys, keys and args in order, got %v", e.lastArgs)
+	}
+}
+
+func TestScript_Load(t *testing.T) {
+	e, commander := newScriptCommander()
+	s := NewScript("return 1")
+	if err := s.Load(commander); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	e.commands = nil
+	if _, err := s.Run(commander, nil); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(e.commands) != 1 || e.commands[0] != "EVALSHA" {
+		t.Errorf("Expected EVALSHA only, got %v", e.commands)
+	}
+}
+
+func TestScriptRegistry(t *testing.T) {
+	e, commander := newScriptCommander()
+	registry := NewScriptRegistry()
+	registry.Register("incr", "return redis.call('INCR', KEYS[1])")
+	registry.Register("decr", "return redis.call('DECR', KEYS[1])")
+	if len(registry.Scripts()) != 2 {
+		t.Errorf("Expected 2 scripts, got %d", len(registry.Scripts()))
+	}
+	if err := registry.Load(commander); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(e.loaded) != 2 {
+		t.Errorf("Expected 2 scripts loaded, got %d", len(e.loaded))
+	}
+	if _, err := registry.Run(commander, "incr", []string{"test:counter"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := registry.Run(commander, "missing", nil); err == nil {
+		t.Errorf("Expected error for unknown script")
+	}
+}
+
+func TestCachedScript(t *testing.T) {
+	if CachedScript("return 1") != CachedScript("return 1") {
+		t.Errorf("Expected same script instance for same source")
+	}
+	if CachedScript("return 1").Hash() != NewScript("return 1").Hash() {
+		t.Errorf("Expected same hash")
+	}
+}
+
+func TestCachedScript_Bounded(t *testing.T) {
+	cache := newScriptCache(2)
+	first := cache.get("return 1")
+	cache.get("return 2")
+	if cache.get("return 1") != first {
+		t.Errorf("Expected cached script instance")
+	}
+	cache.get("return 3")
+	if cache.len() != 2 {
+		t.Errorf("Expected cache bounded to 2, got %d", cache.len())
+	}
+	if _, ok := cache.items["return 2"]; ok {
+		t.Errorf("Expected least recently used script evicted")
+	}
+	for i := 0; i < maxCachedScripts*2; i++ {
+		CachedScript(fmt.Sprintf("return %d", i))
+	}
+	if n := cachedScripts.len(); n > maxCachedScripts {
+		t.Errorf("Expected at most %d cached scripts, got %d", maxCachedScripts, n)
+	}
+}
@@ -0,0 +1,211 @@
+package zredis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrMasterNotFound 哨兵没有返回主节点地址
+var ErrMasterNotFound = errors.New("zredis: sentinel returned no master address")
+
+// Sentinel 通过哨兵发现当前主节点
+// 新连接会通过 ROLE 校验主节点角色，命令返回 READONLY 或连接错误时会在后台重新查询主节点，
+// 主节点变化后连接池中指向旧主节点的连接会在借出时被丢弃
+type Sentinel struct {
+	masterName  string
+	dialOptions []redis.DialOption
+
+	mu         sync.RWMutex
+	addrs      []string
+	masterAddr string
+
+	refreshing int32
+}
+
+// NewSentinel 创建哨兵客户端，opts 用于连接哨兵节点
+func NewSentinel(masterName string, addrs []string, opts ...redis.DialOption) *Sentinel {
+	dialOptions := []redis.DialOption{
+		redis.DialConnectTimeout(time.Duration(1) * time.Second),
+		redis.DialReadTimeout(time.Duration(3) * time.Second),
+		redis.DialWriteTimeout(time.Duration(3) * time.Second),
+	}
+	return &Sentinel{
+		masterName:  masterName,
+		addrs:       append([]string(nil), addrs...),
+		dialOptions: append(dialOptions, opts...),
+	}
+}
+
+// MasterAddr 返回当前主节点地址，尚未查询过时向哨兵查询
+func (s *Sentinel) MasterAddr() (string, error) {
+	s.mu.RLock()
+	addr := s.masterAddr
+	s.mu.RUnlock()
+	if addr != "" {
+		return addr, nil
+	}
+	return s.Refresh()
+}
+
+// Refresh 依次向哨兵查询主节点地址，应答成功的哨兵会被移到列表最前面
+func (s *Sentinel) Refresh() (string, error) {
+	s.mu.RLock()
+	addrs := append([]string(nil), s.addrs...)
+	s.mu.RUnlock()
+
+	var lastErr error = ErrMasterNotFound
+	for i, addr := range addrs {
+		master, err := s.queryMaster(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		s.mu.Lock()
+		if i > 0 {
+			s.addrs[0], s.addrs[i] = s.addrs[i], s.addrs[0]
+		}
+		s.masterAddr = master
+		s.mu.Unlock()
+		return master, nil
+	}
+	return "", fmt.Errorf("zredis: sentinel get master %s: %w", s.masterName, lastErr)
+}
+
+func (s *Sentinel) queryMaster(addr string) (string, error) {
+	c, err := redis.Dial("tcp", addr, s.dialOptions...)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	res, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.masterName))
+	if err == redis.ErrNil {
+		return "", ErrMasterNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(res) != 2 {
+		return "", fmt.Errorf("zredis: unexpected sentinel reply %v", res)
+	}
+	return net.JoinHostPort(res[0], res[1]), nil
+}
+
+// Dial 使用 dial 连接当前主节点并校验 ROLE，失败时重新向哨兵查询并重试一次
+// dial 负责建立连接以及认证、选库等初始化
+func (s *Sentinel) Dial(dial func(addr string) (redis.Conn, error)) (redis.Conn, error) {
+	addr, err := s.MasterAddr()
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.dialMaster(dial, addr)
+	if err == nil {
+		return c, nil
+	}
+	newAddr, refreshErr := s.Refresh()
+	if refreshErr != nil || newAddr == addr {
+		return nil, err
+	}
+	return s.dialMaster(dial, newAddr)
+}
+
+func (s *Sentinel) dialMaster(dial func(addr string) (redis.Conn, error), addr string) (redis.Conn, error) {
+	c, err := dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	values, err := redis.Values(c.Do("ROLE"))
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("zredis: empty ROLE reply from %s", addr)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if role, _ := redis.String(values[0], nil); role != "master" {
+		c.Close()
+		return nil, fmt.Errorf("zredis: %s role is %s, not master", addr, role)
+	}
+	return &sentinelConn{Conn: c, addr: addr, sentinel: s}, nil
+}
+
+// TestOnBorrow 校验连接是否仍指向当前主节点，可用于 redis.Pool 的 TestOnBorrow
+func (s *Sentinel) TestOnBorrow(c redis.Conn) error {
+	if s == nil {
+		return nil
+	}
+	sc, ok := c.(*sentinelConn)
+	if !ok {
+		return nil
+	}
+	s.mu.RLock()
+	addr := s.masterAddr
+	s.mu.RUnlock()
+	if sc.addr != addr {
+		return fmt.Errorf("zredis: master changed from %s to %s", sc.addr, addr)
+	}
+	return nil
+}
+
+// CheckError 命令返回 READONLY 或连接错误时，在后台重新向哨兵查询主节点
+func (s *Sentinel) CheckError(err error) {
+	if s == nil || !isFailoverError(err) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&s.refreshing, 0)
+		s.Refresh()
+	}()
+}
+
+func isFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(redis.Error); ok {
+		return strings.HasPrefix(string(e), "READONLY ")
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sentinelConn 记录连接对应的主节点地址，并在命令出错时通知哨兵客户端
+type sentinelConn struct {
+	redis.Conn
+	addr     string
+	sentinel *Sentinel
+}
+
+func (c *sentinelConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.sentinel.CheckError(err)
+	return reply, err
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.sentinel.CheckError(err)
+	return reply, err
+}
+
+func (c *sentinelConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.sentinel.CheckError(err)
+	return reply, err
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	c.sentinel.CheckError(err)
+	return reply, err
+}
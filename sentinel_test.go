@@ -0,0 +1,131 @@
+package zredis
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// fakeMaster 模拟主节点，切换为从节点后写命令返回 READONLY
+type fakeMaster struct {
+	mu     sync.Mutex
+	role   string
+	writes int
+}
+
+func (m *fakeMaster) setRole(role string) {
+	m.mu.Lock()
+	m.role = role
+	m.mu.Unlock()
+}
+
+func (m *fakeMaster) handle(args []string) interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch args[0] {
+	case "ROLE":
+		return []interface{}{m.role, int64(0), []interface{}{}}
+	case "PING":
+		return "PONG"
+	case "SET":
+		if m.role != "master" {
+			return redis.Error("READONLY You can't write against a read only replica.")
+		}
+		m.writes++
+		return "OK"
+	}
+	return "OK"
+}
+
+func (m *fakeMaster) writeCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writes
+}
+
+func newFakeSentinel(t *testing.T, masterName string, master *fakeServer) (*fakeServer, func(*fakeServer)) {
+	var mu sync.Mutex
+	current := master
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		if args[0] == "SENTINEL" && len(args) == 3 && strings.EqualFold(args[1], "get-master-addr-by-name") {
+			if args[2] != masterName {
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			host, port := current.HostPort()
+			return []string{host, port}
+		}
+		return redis.Error("ERR unknown command")
+	})
+	return sentinel, func(s *fakeServer) {
+		mu.Lock()
+		current = s
+		mu.Unlock()
+	}
+}
+
+func TestConnSentinel_Failover(t *testing.T) {
+	masterA := &fakeMaster{role: "master"}
+	masterB := &fakeMaster{role: "master"}
+	serverA := newFakeServer(t, masterA.handle)
+	serverB := newFakeServer(t, masterB.handle)
+	sentinel, switchMaster := newFakeSentinel(t, "mymaster", serverA)
+
+	// 第一个哨兵不可用时自动使用下一个
+	if err := ConnSentinel("mymaster", []string{"127.0.0.1:1", sentinel.Addr()}, "", 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 全局连接池指向测试结束后关闭的假服务端，结束时重置，避免影响其他测试
+	t.Cleanup(func() { setGlobalPool(nil) })
+	if _, err := CommonCmd("SET", "test:key1", "value1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if masterA.writeCount() != 1 {
+		t.Errorf("Expected write on master A, got %d", masterA.writeCount())
+	}
+
+	// 主从切换
+	masterA.setRole("slave")
+	switchMaster(serverB)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for masterB.writeCount() == 0 && time.Now().Before(deadline) {
+		CommonCmd("SET", "test:key1", "value2")
+		time.Sleep(10 * time.Millisecond)
+	}
+	if masterB.writeCount() == 0 {
+		t.Fatalf("Expected writes to move to master B after failover")
+	}
+	if _, err := CommonCmd("SET", "test:key1", "value3"); err != nil {
+		t.Errorf("Expected no error after failover, got %v", err)
+	}
+}
+
+func TestSentinel_RejectsReplica(t *testing.T) {
+	replica := &fakeMaster{role: "slave"}
+	server := newFakeServer(t, replica.handle)
+	sentinel, _ := newFakeSentinel(t, "mymaster", server)
+
+	s := NewSentinel("mymaster", []string{sentinel.Addr()})
+	_, err := s.Dial(func(addr string) (redis.Conn, error) {
+		return redis.Dial("tcp", addr)
+	})
+	if err == nil || !strings.Contains(err.Error(), "not master") {
+		t.Errorf("Expected role check error, got %v", err)
+	}
+}
+
+func TestSentinel_UnknownMaster(t *testing.T) {
+	master := &fakeMaster{role: "master"}
+	server := newFakeServer(t, master.handle)
+	sentinel, _ := newFakeSentinel(t, "mymaster", server)
+
+	s := NewSentinel("othermaster", []string{sentinel.Addr()})
+	if _, err := s.MasterAddr(); err == nil {
+		t.Errorf("Expected error for unknown master")
+	}
+}
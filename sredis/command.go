@@ -1,19 +1,66 @@
 package sredis
 
 import (
+	"context"
+	"fmt"
 	"github.com/Xuzan9396/zredis"
+	"time"
 )
 
 // 为RedisPool添加统一命令接口
 func (c *RedisPool) GetCommander() zredis.RedisCommander {
-	return zredis.NewRedisCommands(
-		func(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
-			return c.CommonCmd(cmdStr, keysAndArgs...)
-		},
-		func(script string, key string, args ...interface{}) (interface{}, error) {
-			return c.CommonLuaScript(script, key, args...)
-		},
-	)
+	return c.GetCommanderCtx(context.Background())
+}
+
+// GetCommanderCtx 获取绑定了ctx的统一命令接口
+func (c *RedisPool) GetCommanderCtx(ctx context.Context) zredis.RedisCommanderCtx {
+	return zredis.NewRedisCommandsCtx(c.CommonCmdCtx, c.CommonLuaScriptCtx, zredis.WithCommandsCodec(c.codec)).WithContext(ctx)
+}
+
+// NewPipeline 创建基于当前连接池的管道
+func (c *RedisPool) NewPipeline() *zredis.Pipeline {
+	return zredis.NewPipelineWithConn(c.getConn)
+}
+
+// TxPipelined 基于当前连接池执行 MULTI/EXEC 事务
+func (c *RedisPool) TxPipelined(ctx context.Context, fn zredis.TxFunc, opts ...zredis.Tx_func) ([]zredis.PipelineResult, error) {
+	return zredis.TxPipelinedWithConn(ctx, c.getConn, fn, opts...)
+}
+
+// NewLocalCache 创建基于当前连接池的本地缓存，失效通知使用连接池中的专用连接
+func (c *RedisPool) NewLocalCache(opts ...zredis.LocalCache_func) *zredis.LocalCache {
+	return zredis.NewLocalCacheWithConn(c.GetCommander(), c.getConn, opts...)
+}
+
+// NewLocker 创建基于当前连接池的分布式锁
+func (c *RedisPool) NewLocker(opts ...zredis.Lock_func) *zredis.Locker {
+	return zredis.NewLockerWithCommander(c.GetCommander(), opts...)
+}
+
+// NewQueue 创建基于当前连接池的可靠队列
+func (c *RedisPool) NewQueue(name string, opts ...zredis.Queue_func) *zredis.Queue {
+	return zredis.NewQueueWithCommander(c.GetCommander(), name, opts...)
+}
+
+// NewDelayQueue 创建基于当前连接池的延迟队列
+func (c *RedisPool) NewDelayQueue(name string, opts ...zredis.DelayQueue_func) *zredis.DelayQueue {
+	return zredis.NewDelayQueueWithCommander(c.GetCommander(), name, opts...)
+}
+
+// NewStreamWorker 创建基于当前连接池的消费组 worker
+func (c *RedisPool) NewStreamWorker(stream, group, consumer string, opts ...zredis.StreamWorker_func) *zredis.StreamWorker {
+	return zredis.NewStreamWorkerWithCommander(c.GetCommander(), stream, group, consumer, opts...)
+}
+
+// NewSubscriber 创建使用当前连接池专用连接的订阅者
+func (c *RedisPool) NewSubscriber(opts ...zredis.Subscriber_func) *zredis.Subscriber {
+	return zredis.NewSubscriberWithConn(c.getConn, opts...)
+}
+
+// NewKeyspaceListener 创建基于当前连接池的键空间通知监听器，默认监听 Conn 选择的数据库
+func (c *RedisPool) NewKeyspaceListener(opts ...zredis.Keyspace_func) *zredis.KeyspaceListener {
+	opts = append([]zredis.Keyspace_func{zredis.WithKeyspaceDB(c.db)}, opts...)
+	return zredis.NewKeyspaceListenerWithConn(c.GetCommander(), c.getConn, opts...)
 }
 
 // -------------------------  公众函数  -----------------------
@@ -123,6 +170,11 @@ func (c *RedisPool) CommonBitCount(key string) (interface{}, error) {
 	return c.GetCommander().BitCount(key)
 }
 
+// CommonPublish 发布消息，返回收到消息的订阅者数量
+func (c *RedisPool) CommonPublish(channel string, message interface{}) (int64, error) {
+	return c.GetCommander().Publish(channel, message)
+}
+
 func (c *RedisPool) CommonDel(key string) (interface{}, error) {
 	return c.GetCommander().Del(key)
 }
@@ -201,14 +253,34 @@ func (c *RedisPool) CallBackMsgpackCache(redisKey string, funcs zredis.FuncType,
 	if len(opt) > 0 {
 		timeOut = opt[0]
 	}
-	return zredis.CallBackMsgpackCacheWithCommander(c.GetCommander(), redisKey, funcs, timeOut)
+	return c.CallBackCache(redisKey, funcs, zredis.WithCacheTTL(time.Duration(timeOut)*time.Second))
 }
 
 func (c *RedisPool) CallBackMsgpackCacheIn(redisKey string, funcs zredis.FuncTypeInt) ([]byte, error) {
-	return zredis.CallBackMsgpackCacheInWithCommander(c.GetCommander(), redisKey, funcs)
+	return c.CallBackCacheIn(redisKey, funcs)
+}
+
+// CallBackCache 带缓存的回调函数，同一连接池内相同 key 的回源会合并为一次，支持重建锁、旧值兜底和概率提前过期
+func (c *RedisPool) CallBackCache(redisKey string, funcs zredis.FuncType, opts ...zredis.Cache_func) ([]byte, error) {
+	return zredis.CallBackCacheWithCommander(c.GetCommander(), redisKey, funcs, c.cacheOptions(opts)...)
+}
+
+// CallBackCacheIn 根据回源数据中的时间戳设置过期时间，选项同 CallBackCache
+func (c *RedisPool) CallBackCacheIn(redisKey string, funcs zredis.FuncTypeInt, opts ...zredis.Cache_func) ([]byte, error) {
+	return zredis.CallBackCacheInWithCommander(c.GetCommander(), redisKey, funcs, c.cacheOptions(opts)...)
+}
+
+// cacheOptions 以连接池地址作为回源合并的命名空间
+func (c *RedisPool) cacheOptions(opts []zredis.Cache_func) []zredis.Cache_func {
+	return append([]zredis.Cache_func{zredis.WithCacheNamespace(fmt.Sprintf("%p", c))}, opts...)
 }
 
 // 批量删除key
 func (c *RedisPool) CommonDelPattern(patternKey string) (err error) {
 	return c.GetCommander().DelPattern(patternKey)
 }
+
+// CommonRunScript 执行脚本，KEYS 数量不限
+func (c *RedisPool) CommonRunScript(script *zredis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(c.GetCommander(), keys, args...)
+}
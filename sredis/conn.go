@@ -1,120 +1,94 @@
 package sredis
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"github.com/Xuzan9396/zredis"
 	"github.com/garyburd/redigo/redis"
-	"log"
 	"time"
 )
 
 type RedisPool struct {
-	redis_pool  *redis.Pool
-	maxActive   int
-	maxIdle     int
-	idleTime    time.Duration
-	redisOption []redis.DialOption
+	redis_pool *redis.Pool
+	config     *zredis.PoolConfig
+	codec      zredis.Codec
+	db         int
 }
 type Redis_func func(*RedisPool)
 
-func Conn(conn, auth string, dbnum int, opts ...Redis_func) *RedisPool {
+// Conn 创建连接池，连接、认证或选库失败时返回 *zredis.ConnError，
+// 可以用 errors.Is(err, zredis.ErrAuth) 等区分失败阶段
+func Conn(conn, auth string, dbnum int, opts ...Redis_func) (*RedisPool, error) {
+	redisPool := newRedisPool(opts...)
+	redisPool.db = dbnum
+	pool := redisPool.config.NewPool(func() (redis.Conn, error) {
+		return redisPool.config.Dial(conn, auth, dbnum)
+	})
+	if err := redisPool.start(pool); err != nil {
+		return nil, err
+	}
+	return redisPool, nil
+}
 
-	redisPool := &RedisPool{
-		maxActive: 100,
-		maxIdle:   50,
-		idleTime:  300 * time.Second,
-	}
+// ConnSentinel 通过哨兵发现主节点并创建连接池，主从切换后自动连接新的主节点
+func ConnSentinel(masterName string, sentinelAddrs []string, auth string, dbnum int, opts ...Redis_func) (*RedisPool, error) {
+	redisPool := newRedisPool(opts...)
+	redisPool.db = dbnum
+	redisPool.config.Sentinel = zredis.NewSentinel(masterName, sentinelAddrs)
+	pool := redisPool.config.NewPool(func() (redis.Conn, error) {
+		return redisPool.config.Sentinel.Dial(func(addr string) (redis.Conn, error) {
+			return redisPool.config.Dial(addr, auth, dbnum)
+		})
+	})
+
+	if err := redisPool.start(pool); err != nil {
+		return nil, err
+	}
+	return redisPool, nil
+}
+
+func newRedisPool(opts ...Redis_func) *RedisPool {
+	redisPool := &RedisPool{config: zredis.NewPoolConfig()}
 
 	for _, opt := range opts {
 		opt(redisPool)
 	}
-	optionDefalt := []redis.DialOption{
-		redis.DialConnectTimeout(time.Duration(5) * time.Second),
-		redis.DialReadTimeout(time.Duration(10) * time.Second),
-		redis.DialWriteTimeout(time.Duration(10) * time.Second),
-	}
-	if len(redisPool.redisOption) > 0 {
-		optionDefalt = append(optionDefalt, redisPool.redisOption...)
-	}
-	pool := &redis.Pool{
-		MaxActive:   redisPool.maxActive, // 最大活跃 假设应用在高并发场景下，最大并发请求数为 1000，那么可以将 MaxActive 设置为 2000-3000。
-		MaxIdle:     redisPool.maxIdle,   // 最大空闲 ,一般启动时候保持的链接数
-		IdleTimeout: redisPool.idleTime,  // 空闲连接超时 超过这个时间会关闭空闲链接
-		Wait:        false,               // true: 如果达到最大连接数，等待空闲连接 false: 直接返回错误
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial(
-				"tcp",
-				conn,
-				optionDefalt...,
-			)
-			if err != nil {
-				//zlog.F().Error("Redis Redis 连接错误", err)
-				log.Println(err)
-				return nil, err
-			}
-			//验证redis 是否有密码
-			if auth != "" {
-				if _, err := c.Do("AUTH", auth); err != nil {
-
-					//zlog.F().Error("Connect to redis AUTH error", err)
-					log.Println("Connect to redis AUTH error", err)
-					c.Close()
-					return nil, err
-				}
-			}
-			c.Do("select", dbnum)
-
-			return c, nil
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			if time.Since(t) < time.Minute {
-				return nil
-			}
-			_, err := c.Do("PING")
-			return err
-		},
-	}
-
-	c := pool.Get()
-	if c.Err() != nil {
-		//zlog.F().Fatalf("conn:%s,err:%v", conn, c.Err())
-		//log.Fatalf("conn:%s,err:%v", conn, c.Err())
-		log.Println("conn:%s,err:%v", conn, c.Err())
-		pool.Close() // 关闭连接池避免资源泄露
-		return nil
-	}
-	c.Close()
-
-	redisPool.redis_pool = pool
-
 	return redisPool
 }
 
+// start 检查连接并预加载脚本，成功后启用 pool
+// 开启 WithLazyConnect 时失败不返回错误，在后台重试直到连接成功
+func (this *RedisPool) start(pool *redis.Pool) error {
+	this.redis_pool = pool
+	return this.config.Start(pool)
+}
+
 // WithMaxActive 设置最大活跃
 func WithMaxActive(maxActive int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxActive = maxActive
+		r.config.MaxActive = maxActive
 	}
 }
 
 // WithMaxIdle 设置最大空闲
 func WithMaxIdle(maxIdle int) Redis_func {
 	return func(r *RedisPool) {
-		r.maxIdle = maxIdle
+		r.config.MaxIdle = maxIdle
 	}
 }
 
 // WithIdleTime 设置空闲连接超时时间
 func WithIdleTime(idleTime time.Duration) Redis_func {
 	return func(r *RedisPool) {
-		r.idleTime = idleTime
+		r.config.IdleTimeout = idleTime
 	}
 }
 
-// WithRedisOption 设置redis连接选项
+// WithRedisOption 追加redis连接选项，不会覆盖 WithRedisTLS 和 ConnURL 地址参数中的选项，同一选项后追加的生效
 func WithRedisOption(opts ...redis.DialOption) Redis_func {
 	return func(r *RedisPool) {
-		r.redisOption = opts
+		r.config.DialOptions = append(r.config.DialOptions, opts...)
 	}
 }
 
@@ -122,7 +96,7 @@ func WithRedisOption(opts ...redis.DialOption) Redis_func {
 // 注意: 生产环境中应该提供正确的TLS配置，而不是跳过验证
 func WithRedisTLS() Redis_func {
 	return func(r *RedisPool) {
-		r.redisOption = append(r.redisOption, redis.DialUseTLS(true), redis.DialTLSConfig(&tls.Config{
+		r.config.DialOptions = append(r.config.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(&tls.Config{
 			MinVersion: tls.VersionTLS11, // 使用TLS 1.2或更高版本
 			// InsecureSkipVerify: true, // 生产环境中应该移除此选项
 		}))
@@ -138,39 +112,91 @@ func WithRedisTLSConfig(tlsConfig *tls.Config) Redis_func {
 				MinVersion: tls.VersionTLS11,
 			}
 		}
-		r.redisOption = append(r.redisOption, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+		r.config.DialOptions = append(r.config.DialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
 	}
 }
 
-func (this *RedisPool) CommonCmd(cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
-	if this == nil {
-		//zlog.F().Errorf("RedisPool 实例为空")
-		return nil, fmt.Errorf("RedisPool instance is nil")
+// WithUsername 设置 Redis 6 ACL 用户名，与密码一起使用 AUTH username password 认证
+func WithUsername(username string) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Username = username
 	}
+}
 
-	if this.redis_pool == nil {
-		//zlog.F().Errorf("Redis 连接池为空")
-		return nil, fmt.Errorf("redis pool is nil")
+// WithHelloAuth 使用 HELLO 2 AUTH 认证，服务端不支持 HELLO 时回退到 AUTH
+func WithHelloAuth() Redis_func {
+	return func(r *RedisPool) {
+		r.config.Hello = true
+	}
+}
+
+// WithCredentialsProvider 每次建立新连接时调用 provider 获取用户名和密码，覆盖 Conn 传入的密码和 WithUsername
+func WithCredentialsProvider(provider zredis.CredentialsProvider) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Credentials = provider
 	}
+}
 
-	c := this.redis_pool.Get()
-	if c == nil {
-		//zlog.F().Errorf("获取 Redis 连接失败: 连接为空")
-		return nil, fmt.Errorf("redis connection is nil")
+// WithWait 连接数达到 MaxActive 时等待空闲连接，默认 false 直接返回 redis.ErrPoolExhausted
+// 等待时间受 ctx 控制，等待次数和时间见 Stats
+func WithWait(wait bool) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Wait = wait
 	}
-	if c.Err() != nil {
-		//zlog.F().Errorf("Redis DoCommonCmd: %v", c.Err())
-		return nil, c.Err()
+}
+
+// WithLazyConnect 启动时连接失败不返回错误，每隔 retryInterval（指数退避）在后台重试直到连接成功，
+// 期间执行命令会返回连接错误，retryInterval <= 0 时为 1 秒
+func WithLazyConnect(retryInterval time.Duration) Redis_func {
+	return func(r *RedisPool) {
+		if retryInterval <= 0 {
+			retryInterval = time.Second
+		}
+		r.config.LazyRetry = retryInterval
 	}
-	defer c.Close()
-	res, err := c.Do(cmdStr, keysAndArgs...)
-	if err == nil {
-		return res, err
+}
+
+// WithScripts 连接时使用 SCRIPT LOAD 预加载Lua脚本
+func WithScripts(scripts ...*zredis.Script) Redis_func {
+	return func(r *RedisPool) {
+		r.config.Scripts = append(r.config.Scripts, scripts...)
+	}
+}
+
+func (this *RedisPool) CommonCmd(cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	return this.CommonCmdCtx(context.Background(), cmdStr, keysAndArgs...)
+}
+
+// CommonCmdCtx 执行通用的 Redis 命令，遵守ctx的取消与截止时间
+func (this *RedisPool) CommonCmdCtx(ctx context.Context, cmdStr string, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	c, err := this.getConn(ctx)
+	if err != nil {
+		//zlog.F().Errorf("Redis DoCommonCmd: %v", err)
+		return nil, err
 	}
-	return nil, err
+	return zredis.DoContext(ctx, c, cmdStr, keysAndArgs...)
 }
 
 func (this *RedisPool) CommonLuaScript(script string, key string, args ...interface{}) (reply interface{}, err error) {
+	return this.CommonLuaScriptCtx(context.Background(), script, key, args...)
+}
+
+// CommonLuaScriptCtx 执行 Lua 脚本命令，遵守ctx的取消与截止时间
+func (this *RedisPool) CommonLuaScriptCtx(ctx context.Context, script string, key string, args ...interface{}) (reply interface{}, err error) {
+	c, err := this.getConn(ctx)
+	if err != nil {
+		//zlog.F().Errorf("LuaCommonCmd get redis error: %v", err)
+		return nil, err
+	}
+
+	lua := zredis.CachedScript(script)
+	return zredis.RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+		return lua.Do(c, []string{key}, args...)
+	})
+}
+
+// getConn 从连接池获取连接，获取失败时返回错误
+func (this *RedisPool) getConn(ctx context.Context) (redis.Conn, error) {
 	if this == nil {
 		//zlog.F().Errorf("RedisPool 实例为空")
 		return nil, fmt.Errorf("RedisPool instance is nil")
@@ -181,17 +207,29 @@ func (this *RedisPool) CommonLuaScript(script string, key string, args ...interf
 		return nil, fmt.Errorf("redis pool is nil")
 	}
 
-	c := this.redis_pool.Get()
-	if c == nil {
-		//zlog.F().Errorf("获取 Redis 连接失败: 连接为空")
-		return nil, fmt.Errorf("redis connection is nil")
+	return this.config.Tracker.Get(ctx, this.redis_pool)
+}
+
+// Close 关闭连接池，拒绝新的命令并立即关闭所有连接，正在执行的命令会返回错误
+func (this *RedisPool) Close() error {
+	if this == nil || this.redis_pool == nil {
+		return nil
 	}
-	if c.Err() != nil {
-		//zlog.F().Errorf("LuaCommonCmd get redis error: %v", c.Err())
-		return nil, c.Err()
+	return this.config.Tracker.Close(this.redis_pool)
+}
+
+// Shutdown 优雅关闭连接池：拒绝新的命令，立即关闭 Subscriber 等持有的订阅连接，等待执行中的命令（包括 BRPOP 等阻塞命令）结束后关闭连接，
+// ctx 结束时强制关闭剩余连接并返回 ctx.Err()
+func (this *RedisPool) Shutdown(ctx context.Context) error {
+	if this == nil || this.redis_pool == nil {
+		return nil
 	}
-	defer c.Close()
+	return this.config.Tracker.Shutdown(ctx, this.redis_pool)
+}
 
-	lua := redis.NewScript(1, script)
-	return lua.Do(c, append([]interface{}{key}, args...)...)
+// WithCodec 设置 SetObject/GetObject 等对象读写使用的编解码器，默认 zredis.JSONCodec
+func WithCodec(codec zredis.Codec) Redis_func {
+	return func(r *RedisPool) {
+		r.codec = codec
+	}
 }
@@ -1,6 +1,8 @@
 package sredis_test
 
 import (
+	"errors"
+	"github.com/Xuzan9396/zredis"
 	"github.com/Xuzan9396/zredis/sredis"
 	"github.com/garyburd/redigo/redis"
 	"testing"
@@ -35,7 +37,12 @@ func TestRedisPool_CommonCmd(t *testing.T) {
 	conn := "127.0.0.1:6379"
 	passwd := "27252725"
 	dbnum := 0
-	client := sredis.Conn(conn, passwd, dbnum, sredis.WithIdleTime(60*time.Second))//sredis.WithRedisTLS(),
+	client, err := sredis.Conn(conn, passwd, dbnum, sredis.WithIdleTime(60*time.Second))//sredis.WithRedisTLS(),
+	if errors.Is(err, zredis.ErrDial) {
+		t.Skipf("redis not available: %v", err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
 
 	client.CommonHset("test_lua_hset", "coin", 100)
 	client.CommonHset("test_lua_hset", "coin_free", 10)
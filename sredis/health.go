@@ -0,0 +1,27 @@
+package sredis
+
+import (
+	"context"
+
+	"github.com/Xuzan9396/zredis"
+)
+
+// Stats 返回连接池的统计
+func (this *RedisPool) Stats() zredis.PoolStats {
+	if this == nil {
+		return zredis.PoolStats{}
+	}
+	return this.config.Tracker.Stats(this.redis_pool)
+}
+
+// Ping 检查连接池能否执行命令，可用于就绪探针
+func (this *RedisPool) Ping(ctx context.Context) error {
+	return zredis.PingConn(ctx, this.getConn)
+}
+
+// HealthCheck 执行 PING 并返回延迟和连接池统计
+func (this *RedisPool) HealthCheck(ctx context.Context) zredis.Health {
+	h := zredis.CheckHealth(ctx, this.getConn)
+	h.Stats = this.Stats()
+	return h
+}
@@ -0,0 +1,387 @@
+package zredis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// XMessage 流中的一条消息，Values 为 nil 表示消息已被删除（XCLAIM、XREADGROUP 读取待确认消息时可能出现）
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XStream XREAD/XREADGROUP 返回的单个流的消息
+type XStream struct {
+	Stream   string
+	Messages []XMessage
+}
+
+// XAddArgs XADD 参数
+type XAddArgs struct {
+	Stream string
+	// ID 消息 id，默认 "*" 由服务端生成
+	ID string
+	// Values 消息字段，按字段名排序写入
+	Values map[string]interface{}
+	// NoMkStream 流不存在时不创建（Redis 6.2+）
+	NoMkStream bool
+	// MaxLen 大于 0 时按长度裁剪
+	MaxLen int64
+	// MinID 不为空时裁剪 id 小于它的消息（Redis 6.2+），与 MaxLen 二选一
+	MinID string
+	// Approx 使用 "~" 近似裁剪，性能更好
+	Approx bool
+	// Limit 近似裁剪时每次最多删除的条数（Redis 6.2+）
+	Limit int64
+}
+
+// XReadArgs XREAD 参数
+type XReadArgs struct {
+	// Streams 依次为所有流的 key 和对应的起始 id，如 {"s1", "s2", "0", "$"}
+	Streams []string
+	// Count 大于 0 时每个流最多返回的条数
+	Count int64
+	// Block 阻塞等待时间，0 表示不阻塞，小于 0 表示一直阻塞；超时返回 ErrNil
+	Block time.Duration
+}
+
+// XReadGroupArgs XREADGROUP 参数
+type XReadGroupArgs struct {
+	Group    string
+	Consumer string
+	// Streams 依次为所有流的 key 和对应的 id，">" 读取新消息，"0" 读取本消费者待确认的消息
+	Streams []string
+	Count   int64
+	// Block 阻塞等待时间，0 表示不阻塞，小于 0 表示一直阻塞；超时返回 ErrNil
+	Block time.Duration
+	// NoAck 读取后不进入待确认列表
+	NoAck bool
+}
+
+// XPending 消费组待确认消息的概要
+type XPending struct {
+	Count     int64
+	Lower     string
+	Higher    string
+	Consumers map[string]int64
+}
+
+// XPendingExtArgs XPENDING 详细查询参数
+type XPendingExtArgs struct {
+	Stream string
+	Group  string
+	// Idle 大于 0 时只返回空闲超过该时间的消息（Redis 6.2+）
+	Idle time.Duration
+	// Start、End 默认 "-" 和 "+"
+	Start string
+	End   string
+	Count int64
+	// Consumer 不为空时只返回该消费者的消息
+	Consumer string
+}
+
+// XPendingEntry 待确认消息
+type XPendingEntry struct {
+	ID       string
+	Consumer string
+	// Idle 距上次投递的时间
+	Idle time.Duration
+	// RetryCount 投递次数
+	RetryCount int64
+}
+
+// XClaimArgs XCLAIM 参数
+type XClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// MinIdle 只认领空闲超过该时间的消息
+	MinIdle time.Duration
+	IDs     []string
+}
+
+// XAutoClaimArgs XAUTOCLAIM 参数（Redis 6.2+）
+type XAutoClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	MinIdle  time.Duration
+	// Start 扫描的起始 id，默认 "0-0"，继续扫描时使用上次返回的 next
+	Start string
+	Count int64
+}
+
+func (r *redisCommands) XAdd(a XAddArgs) (string, error) {
+	args := []interface{}{a.Stream}
+	if a.NoMkStream {
+		args = append(args, "NOMKSTREAM")
+	}
+	if a.MaxLen > 0 || a.MinID != "" {
+		if a.MaxLen > 0 {
+			args = append(args, "MAXLEN")
+		} else {
+			args = append(args, "MINID")
+		}
+		if a.Approx {
+			args = append(args, "~")
+		}
+		if a.MaxLen > 0 {
+			args = append(args, a.MaxLen)
+		} else {
+			args = append(args, a.MinID)
+		}
+		if a.Approx && a.Limit > 0 {
+			args = append(args, "LIMIT", a.Limit)
+		}
+	}
+	id := a.ID
+	if id == "" {
+		id = "*"
+	}
+	args = append(args, id)
+	fields := make([]string, 0, len(a.Values))
+	for field := range a.Values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		args = append(args, field, a.Values[field])
+	}
+	return redis.String(r.do("XADD", args...))
+}
+
+func (r *redisCommands) XLen(key string) (int64, error) {
+	return redis.Int64(r.do("XLEN", key))
+}
+
+func (r *redisCommands) XDel(key string, ids ...string) (int64, error) {
+	return redis.Int64(r.do("XDEL", appendStrings([]interface{}{key}, ids...)...))
+}
+
+func (r *redisCommands) XRange(key, start, end string, count int64) ([]XMessage, error) {
+	args := []interface{}{key, start, end}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return parseXMessages(r.do("XRANGE", args...))
+}
+
+func (r *redisCommands) XRevRange(key, end, start string, count int64) ([]XMessage, error) {
+	args := []interface{}{key, end, start}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return parseXMessages(r.do("XREVRANGE", args...))
+}
+
+func (r *redisCommands) XRead(a XReadArgs) ([]XStream, error) {
+	args := xReadArgs(nil, a.Count, a.Block)
+	args = appendStrings(append(args, "STREAMS"), a.Streams...)
+	if a.Block != 0 {
+		return parseXStreams(r.doBlock(a.Block, "XREAD", args...))
+	}
+	return parseXStreams(r.do("XREAD", args...))
+}
+
+func (r *redisCommands) XReadGroup(a XReadGroupArgs) ([]XStream, error) {
+	args := xReadArgs([]interface{}{"GROUP", a.Group, a.Consumer}, a.Count, a.Block)
+	if a.NoAck {
+		args = append(args, "NOACK")
+	}
+	args = appendStrings(append(args, "STREAMS"), a.Streams...)
+	if a.Block != 0 {
+		return parseXStreams(r.doBlock(a.Block, "XREADGROUP", args...))
+	}
+	return parseXStreams(r.do("XREADGROUP", args...))
+}
+
+func (r *redisCommands) XAck(key, group string, ids ...string) (int64, error) {
+	return redis.Int64(r.do("XACK", appendStrings([]interface{}{key, group}, ids...)...))
+}
+
+func (r *redisCommands) XPending(key, group string) (*XPending, error) {
+	values, err := redis.Values(r.do("XPENDING", key, group))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("zredis: unexpected XPENDING reply %v", values)
+	}
+	pending := &XPending{Consumers: make(map[string]int64)}
+	pending.Count, _ = redis.Int64(values[0], nil)
+	pending.Lower, _ = redis.String(values[1], nil)
+	pending.Higher, _ = redis.String(values[2], nil)
+	consumers, _ := redis.Values(values[3], nil)
+	for _, c := range consumers {
+		pair, err := redis.Values(c, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("zredis: unexpected XPENDING consumer %v", c)
+		}
+		name, _ := redis.String(pair[0], nil)
+		pending.Consumers[name], _ = redis.Int64(pair[1], nil)
+	}
+	return pending, nil
+}
+
+func (r *redisCommands) XPendingExt(a XPendingExtArgs) ([]XPendingEntry, error) {
+	args := []interface{}{a.Stream, a.Group}
+	if a.Idle > 0 {
+		args = append(args, "IDLE", durationMs(a.Idle))
+	}
+	start, end := a.Start, a.End
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+	args = append(args, start, end, a.Count)
+	if a.Consumer != "" {
+		args = append(args, a.Consumer)
+	}
+	values, err := redis.Values(r.do("XPENDING", args...))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]XPendingEntry, 0, len(values))
+	for _, v := range values {
+		fields, err := redis.Values(v, nil)
+		if err != nil || len(fields) != 4 {
+			return nil, fmt.Errorf("zredis: unexpected XPENDING entry %v", v)
+		}
+		var entry XPendingEntry
+		entry.ID, _ = redis.String(fields[0], nil)
+		entry.Consumer, _ = redis.String(fields[1], nil)
+		idle, _ := redis.Int64(fields[2], nil)
+		entry.Idle = time.Duration(idle) * time.Millisecond
+		entry.RetryCount, _ = redis.Int64(fields[3], nil)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *redisCommands) XClaim(a XClaimArgs) ([]XMessage, error) {
+	args := []interface{}{a.Stream, a.Group, a.Consumer, a.MinIdle.Milliseconds()}
+	return parseXMessages(r.do("XCLAIM", appendStrings(args, a.IDs...)...))
+}
+
+func (r *redisCommands) XAutoClaim(a XAutoClaimArgs) ([]XMessage, string, error) {
+	start := a.Start
+	if start == "" {
+		start = "0-0"
+	}
+	args := []interface{}{a.Stream, a.Group, a.Consumer, a.MinIdle.Milliseconds(), start}
+	if a.Count > 0 {
+		args = append(args, "COUNT", a.Count)
+	}
+	values, err := redis.Values(r.do("XAUTOCLAIM", args...))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(values) < 2 {
+		return nil, "", fmt.Errorf("zredis: unexpected XAUTOCLAIM reply %v", values)
+	}
+	next, _ := redis.String(values[0], nil)
+	messages, err := parseXMessages(values[1], nil)
+	return messages, next, err
+}
+
+func (r *redisCommands) XGroupCreate(key, group, start string, mkStream bool) error {
+	args := []interface{}{"CREATE", key, group, start}
+	if mkStream {
+		args = append(args, "MKSTREAM")
+	}
+	_, err := r.do("XGROUP", args...)
+	return err
+}
+
+func (r *redisCommands) XGroupSetID(key, group, id string) error {
+	_, err := r.do("XGROUP", "SETID", key, group, id)
+	return err
+}
+
+func (r *redisCommands) XGroupDestroy(key, group string) (int64, error) {
+	return redis.Int64(r.do("XGROUP", "DESTROY", key, group))
+}
+
+func (r *redisCommands) XGroupCreateConsumer(key, group, consumer string) (int64, error) {
+	return redis.Int64(r.do("XGROUP", "CREATECONSUMER", key, group, consumer))
+}
+
+func (r *redisCommands) XGroupDelConsumer(key, group, consumer string) (int64, error) {
+	return redis.Int64(r.do("XGROUP", "DELCONSUMER", key, group, consumer))
+}
+
+// xReadArgs 追加 COUNT 和 BLOCK 参数
+func xReadArgs(args []interface{}, count int64, block time.Duration) []interface{} {
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if block > 0 {
+		args = append(args, "BLOCK", durationMs(block))
+	} else if block < 0 {
+		args = append(args, "BLOCK", 0)
+	}
+	return args
+}
+
+func appendStrings(args []interface{}, values ...string) []interface{} {
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+// parseXMessages 解析 [[id, [field, value, ...]], ...] 格式的回复
+func parseXMessages(reply interface{}, err error) ([]XMessage, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]XMessage, 0, len(values))
+	for _, v := range values {
+		// Redis 7 以下 XCLAIM 遇到已删除的消息时返回 nil
+		if v == nil {
+			continue
+		}
+		entry, err := redis.Values(v, nil)
+		if err != nil || len(entry) != 2 {
+			return nil, fmt.Errorf("zredis: unexpected stream entry %v", v)
+		}
+		var msg XMessage
+		msg.ID, _ = redis.String(entry[0], nil)
+		if entry[1] != nil {
+			if msg.Values, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// parseXStreams 解析 [[stream, messages], ...] 格式的回复，阻塞超时返回 ErrNil
+func parseXStreams(reply interface{}, err error) ([]XStream, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]XStream, 0, len(values))
+	for _, v := range values {
+		pair, err := redis.Values(v, nil)
+		if err != nil || len(pair) != 2 {
+			return nil, fmt.Errorf("zredis: unexpected stream reply %v", v)
+		}
+		var stream XStream
+		stream.Stream, _ = redis.String(pair[0], nil)
+		if stream.Messages, err = parseXMessages(pair[1], nil); err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
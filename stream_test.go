@@ -0,0 +1,202 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func newTestStream(t *testing.T) (RedisCommanderCtx, string) {
+	commander, _ := newRedisTestCommander(t)
+	stream := "test:stream:" + t.Name()
+	commander.Del(stream)
+	commander.Del(stream + ":dead")
+	t.Cleanup(func() {
+		commander.Del(stream)
+		commander.Del(stream + ":dead")
+	})
+	return commander, stream
+}
+
+func TestStream_AddRangeRead(t *testing.T) {
+	commander, stream := newTestStream(t)
+	var ids []string
+	for i, v := range []string{"a", "b", "c"} {
+		id, err := commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": v, "i": i}})
+		if err != nil {
+			t.Fatalf("XAdd err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if n, _ := commander.XLen(stream); n != 3 {
+		t.Errorf("Expected length 3, got %d", n)
+	}
+
+	messages, err := commander.XRange(stream, "-", "+", 0)
+	if err != nil || len(messages) != 3 {
+		t.Fatalf("XRange = %v, %v", messages, err)
+	}
+	if messages[0].ID != ids[0] || messages[0].Values["v"] != "a" || messages[2].Values["i"] != "2" {
+		t.Errorf("Unexpected messages %+v", messages)
+	}
+	if messages, _ := commander.XRevRange(stream, "+", "-", 1); len(messages) != 1 || messages[0].ID != ids[2] {
+		t.Errorf("Unexpected XRevRange %+v", messages)
+	}
+
+	streams, err := commander.XRead(XReadArgs{Streams: []string{stream, ids[0]}, Count: 10})
+	if err != nil || len(streams) != 1 || streams[0].Stream != stream || len(streams[0].Messages) != 2 {
+		t.Fatalf("XRead = %+v, %v", streams, err)
+	}
+	if _, err := commander.XRead(XReadArgs{Streams: []string{stream, ids[2]}, Block: 50 * time.Millisecond}); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil on block timeout, got %v", err)
+	}
+
+	commander.XAdd(XAddArgs{Stream: stream, MaxLen: 2, Values: map[string]interface{}{"v": "d"}})
+	if n, _ := commander.XLen(stream); n != 2 {
+		t.Errorf("Expected MAXLEN to trim to 2, got %d", n)
+	}
+	if n, err := commander.XDel(stream, ids[2]); err != nil || n != 1 {
+		t.Errorf("XDel = %d, %v", n, err)
+	}
+}
+
+func TestStream_BlockPastReadTimeout(t *testing.T) {
+	commander, stream := newTestStream(t)
+	short, _ := newRedisTestCommander(t, redis.DialReadTimeout(100*time.Millisecond))
+
+	if _, err := short.XRead(XReadArgs{Streams: []string{stream, "$"}, Block: 300 * time.Millisecond}); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil after blocking past the read timeout, got %v", err)
+	}
+	if err := commander.XGroupCreate(stream, "g", "$", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := short.XReadGroup(XReadGroupArgs{Group: "g", Consumer: "c1", Streams: []string{stream, ">"}, Block: 300 * time.Millisecond}); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil after blocking past the read timeout, got %v", err)
+	}
+
+	time.AfterFunc(300*time.Millisecond, func() {
+		commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": "a"}})
+	})
+	streams, err := short.XReadGroup(XReadGroupArgs{Group: "g", Consumer: "c1", Streams: []string{stream, ">"}, Block: -1})
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 1 {
+		t.Errorf("Expected blocking forever to receive the message, got %+v %v", streams, err)
+	}
+}
+
+func TestStream_Group(t *testing.T) {
+	commander, stream := newTestStream(t)
+	if err := commander.XGroupCreate(stream, "g", "$", true); err != nil {
+		t.Fatalf("XGroupCreate err: %v", err)
+	}
+	id, _ := commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": "a"}})
+
+	streams, err := commander.XReadGroup(XReadGroupArgs{Group: "g", Consumer: "c1", Streams: []string{stream, ">"}, Count: 10})
+	if err != nil || len(streams) != 1 || len(streams[0].Messages) != 1 || streams[0].Messages[0].ID != id {
+		t.Fatalf("XReadGroup = %+v, %v", streams, err)
+	}
+
+	pending, err := commander.XPending(stream, "g")
+	if err != nil || pending.Count != 1 || pending.Lower != id || pending.Consumers["c1"] != 1 {
+		t.Fatalf("XPending = %+v, %v", pending, err)
+	}
+	entries, err := commander.XPendingExt(XPendingExtArgs{Stream: stream, Group: "g", Count: 10})
+	if err != nil || len(entries) != 1 || entries[0].Consumer != "c1" || entries[0].RetryCount != 1 {
+		t.Fatalf("XPendingExt = %+v, %v", entries, err)
+	}
+
+	claimed, err := commander.XClaim(XClaimArgs{Stream: stream, Group: "g", Consumer: "c2", IDs: []string{id}})
+	if err != nil || len(claimed) != 1 || claimed[0].Values["v"] != "a" {
+		t.Fatalf("XClaim = %+v, %v", claimed, err)
+	}
+	if n, err := commander.XAck(stream, "g", id); err != nil || n != 1 {
+		t.Errorf("XAck = %d, %v", n, err)
+	}
+	if n, err := commander.XGroupDestroy(stream, "g"); err != nil || n != 1 {
+		t.Errorf("XGroupDestroy = %d, %v", n, err)
+	}
+}
+
+func TestStreamWorker_RecoverPending(t *testing.T) {
+	commander, stream := newTestStream(t)
+	commander.XGroupCreate(stream, "g", "0", true)
+	commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": "crashed"}})
+	// 另一个消费者读取后崩溃，消息留在待确认列表
+	commander.XReadGroup(XReadGroupArgs{Group: "g", Consumer: "dead", Streams: []string{stream, ">"}})
+	commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": "new"}})
+
+	w := NewStreamWorkerWithCommander(commander, stream, "g", "c1",
+		WithStreamWorkerBlock(50*time.Millisecond),
+		WithStreamWorkerMinIdle(100*time.Millisecond),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	got := map[string]bool{}
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx, func(ctx context.Context, msg XMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[msg.Values["v"]] = true
+			return nil
+		})
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if !got["crashed"] || !got["new"] {
+		t.Errorf("Expected both messages processed, got %v", got)
+	}
+	if pending, _ := commander.XPending(stream, "g"); pending.Count != 0 {
+		t.Errorf("Expected no pending messages, got %+v", pending)
+	}
+}
+
+func TestStreamWorker_DeadLetter(t *testing.T) {
+	commander, stream := newTestStream(t)
+	w := NewStreamWorkerWithCommander(commander, stream, "g", "c1",
+		WithStreamWorkerStart("0"),
+		WithStreamWorkerMinIdle(10*time.Millisecond),
+		WithStreamWorkerMaxDeliveries(2, ""),
+	)
+	ctx := context.Background()
+	if err := w.EnsureGroup(ctx); err != nil {
+		t.Fatalf("EnsureGroup err: %v", err)
+	}
+	if err := w.EnsureGroup(ctx); err != nil {
+		t.Fatalf("EnsureGroup should ignore existing group, got %v", err)
+	}
+	id, _ := commander.XAdd(XAddArgs{Stream: stream, Values: map[string]interface{}{"v": "bad"}})
+	commander.XReadGroup(XReadGroupArgs{Group: "g", Consumer: "c1", Streams: []string{stream, ">"}})
+
+	time.Sleep(20 * time.Millisecond)
+	claimed, err := w.Claim(ctx)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != id {
+		t.Fatalf("Claim = %+v, %v", claimed, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if claimed, err := w.Claim(ctx); err != nil || len(claimed) != 0 {
+		t.Fatalf("Expected message to be dead lettered, got %+v, %v", claimed, err)
+	}
+	dead, err := commander.XRange(stream+":dead", "-", "+", 0)
+	if err != nil || len(dead) != 1 || dead[0].Values["v"] != "bad" || dead[0].Values["_id"] != id {
+		t.Errorf("Unexpected dead letters %+v, %v", dead, err)
+	}
+}
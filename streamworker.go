@@ -0,0 +1,260 @@
+package zredis
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+type streamWorkerOptions struct {
+	count         int64
+	block         time.Duration
+	minIdle       time.Duration
+	maxDeliveries int64
+	start         string
+	deadStream    string
+}
+
+// StreamWorker_func 消费组 worker 的配置选项
+type StreamWorker_func func(*streamWorkerOptions)
+
+// WithStreamWorkerCount 设置每次读取的最大消息数，默认 10
+func WithStreamWorkerCount(n int64) StreamWorker_func {
+	return func(o *streamWorkerOptions) {
+		o.count = n
+	}
+}
+
+// WithStreamWorkerBlock 设置每次阻塞读取的时间，也决定了停止时的最长等待，默认 1 秒
+func WithStreamWorkerBlock(block time.Duration) StreamWorker_func {
+	return func(o *streamWorkerOptions) {
+		o.block = block
+	}
+}
+
+// WithStreamWorkerMinIdle 设置待确认消息空闲多久后被认领重新处理，默认 30 秒
+// 包括其他崩溃消费者的消息和本消费者处理失败的消息
+func WithStreamWorkerMinIdle(idle time.Duration) StreamWorker_func {
+	return func(o *streamWorkerOptions) {
+		o.minIdle = idle
+	}
+}
+
+// WithStreamWorkerMaxDeliveries 设置最大投递次数，超过后消息被确认并写入死信流 deadStream，默认不限制
+// deadStream 为空时使用 "<stream>:dead"
+func WithStreamWorkerMaxDeliveries(n int64, deadStream string) StreamWorker_func {
+	return func(o *streamWorkerOptions) {
+		o.maxDeliveries = n
+		o.deadStream = deadStream
+	}
+}
+
+// WithStreamWorkerStart 设置消费组不存在时创建的起始 id，默认 "$" 只消费新消息，"0" 从头消费
+func WithStreamWorkerStart(id string) StreamWorker_func {
+	return func(o *streamWorkerOptions) {
+		o.start = id
+	}
+}
+
+// StreamWorker 消费组 worker，启动时先处理本消费者未确认的消息，运行期间定期认领空闲超时的待确认消息
+// handler 返回 nil 时确认消息，返回错误时消息留在待确认列表，空闲超过 MinIdle 后重新投递
+type StreamWorker struct {
+	commander RedisCommander
+	stream    string
+	group     string
+	consumer  string
+	opts      streamWorkerOptions
+}
+
+// NewStreamWorker 创建基于全局连接池的消费组 worker
+func NewStreamWorker(stream, group, consumer string, opts ...StreamWorker_func) *StreamWorker {
+	initGlobalCommander()
+	return NewStreamWorkerWithCommander(globalCommander, stream, group, consumer, opts...)
+}
+
+// NewStreamWorkerWithCommander 使用指定的命令实例创建消费组 worker
+func NewStreamWorkerWithCommander(commander RedisCommander, stream, group, consumer string, opts ...StreamWorker_func) *StreamWorker {
+	w := &StreamWorker{
+		commander: commander,
+		stream:    stream,
+		group:     group,
+		consumer:  consumer,
+		opts: streamWorkerOptions{
+			count:   10,
+			block:   time.Second,
+			minIdle: 30 * time.Second,
+			start:   "$",
+		},
+	}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	if w.opts.deadStream == "" {
+		w.opts.deadStream = stream + ":dead"
+	}
+	return w
+}
+
+// EnsureGroup 创建消费组，流不存在时一并创建，消费组已存在时忽略
+func (w *StreamWorker) EnsureGroup(ctx context.Context) error {
+	err := commanderWithContext(w.commander, ctx).XGroupCreate(w.stream, w.group, w.opts.start, true)
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Run 循环处理消息直到 ctx 结束，处理完当前消息后返回
+// 阻塞读取不绑定 ctx，停止时最多等待 WithStreamWorkerBlock 设置的时间
+func (w *StreamWorker) Run(ctx context.Context, handler func(ctx context.Context, msg XMessage) error) error {
+	if err := w.EnsureGroup(ctx); err != nil {
+		return err
+	}
+	bg := context.Background()
+
+	// 先处理上次退出时本消费者未确认的消息
+	for last := "0"; ctx.Err() == nil; {
+		messages, err := w.read(bg, last, 0)
+		if err != nil {
+			log.Printf("stream %s read pending err:%v", w.stream, err)
+			break
+		}
+		if len(messages) == 0 {
+			break
+		}
+		w.handle(ctx, messages, handler)
+		last = messages[len(messages)-1].ID
+	}
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= w.opts.minIdle/2 {
+			lastClaim = time.Now()
+			messages, err := w.Claim(bg)
+			if err != nil {
+				log.Printf("stream %s claim err:%v", w.stream, err)
+			}
+			w.handle(ctx, messages, handler)
+		}
+
+		messages, err := w.read(bg, ">", w.opts.block)
+		if err != nil {
+			log.Printf("stream %s read err:%v", w.stream, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.opts.block):
+			}
+			continue
+		}
+		w.handle(ctx, messages, handler)
+	}
+	return ctx.Err()
+}
+
+// Claim 认领空闲超过 MinIdle 的待确认消息，超过最大投递次数的消息写入死信流
+func (w *StreamWorker) Claim(ctx context.Context) ([]XMessage, error) {
+	commander := commanderWithContext(w.commander, ctx)
+	var claimed []XMessage
+	start, last := "-", ""
+	for {
+		// 不使用 IDLE 和 "(" 排他区间以兼容 Redis 6.2 以下版本，翻页时跳过上一页的最后一条
+		entries, err := commander.XPendingExt(XPendingExtArgs{Stream: w.stream, Group: w.group, Start: start, Count: w.opts.count + 1})
+		if err != nil {
+			return claimed, err
+		}
+		if len(entries) > 0 && entries[0].ID == last {
+			entries = entries[1:]
+		}
+		var ids, dead []string
+		for _, entry := range entries {
+			if entry.Idle < w.opts.minIdle {
+				continue
+			}
+			if w.opts.maxDeliveries > 0 && entry.RetryCount >= w.opts.maxDeliveries {
+				dead = append(dead, entry.ID)
+			} else {
+				ids = append(ids, entry.ID)
+			}
+		}
+		if len(dead) > 0 {
+			if err := w.deadLetter(ctx, dead); err != nil {
+				return claimed, err
+			}
+		}
+		if len(ids) > 0 {
+			messages, err := commander.XClaim(XClaimArgs{Stream: w.stream, Group: w.group, Consumer: w.consumer, MinIdle: w.opts.minIdle, IDs: ids})
+			if err != nil {
+				return claimed, err
+			}
+			claimed = append(claimed, messages...)
+		}
+		if int64(len(entries)) < w.opts.count {
+			return claimed, nil
+		}
+		last = entries[len(entries)-1].ID
+		start = last
+	}
+}
+
+// deadLetter 把消息写入死信流并确认
+func (w *StreamWorker) deadLetter(ctx context.Context, ids []string) error {
+	commander := commanderWithContext(w.commander, ctx)
+	for _, id := range ids {
+		messages, err := commander.XRange(w.stream, id, id, 1)
+		if err != nil {
+			return err
+		}
+		if len(messages) > 0 {
+			values := make(map[string]interface{}, len(messages[0].Values)+1)
+			for k, v := range messages[0].Values {
+				values[k] = v
+			}
+			values["_id"] = id
+			if _, err := commander.XAdd(XAddArgs{Stream: w.opts.deadStream, Values: values}); err != nil {
+				return err
+			}
+		}
+		if _, err := commander.XAck(w.stream, w.group, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *StreamWorker) read(ctx context.Context, id string, block time.Duration) ([]XMessage, error) {
+	streams, err := commanderWithContext(w.commander, ctx).XReadGroup(XReadGroupArgs{
+		Group:    w.group,
+		Consumer: w.consumer,
+		Streams:  []string{w.stream, id},
+		Count:    w.opts.count,
+		Block:    block,
+	})
+	if err == ErrNil {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	return streams[0].Messages, nil
+}
+
+func (w *StreamWorker) handle(ctx context.Context, messages []XMessage, handler func(ctx context.Context, msg XMessage) error) {
+	bg := context.Background()
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			// 未处理的消息留在待确认列表，下次启动时处理
+			return
+		}
+		// 已被删除的消息直接确认
+		if msg.Values != nil {
+			if err := handler(ctx, msg); err != nil {
+				log.Printf("stream %s message %s err:%v", w.stream, msg.ID, err)
+				continue
+			}
+		}
+		if _, err := commanderWithContext(w.commander, bg).XAck(w.stream, w.group, msg.ID); err != nil {
+			log.Printf("stream %s ack %s err:%v", w.stream, msg.ID, err)
+		}
+	}
+}
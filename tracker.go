@@ -0,0 +1,336 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrPoolClosed 连接池已经关闭
+var ErrPoolClosed = errors.New("zredis: redis pool closed")
+
+// waitThreshold 连接数已达上限时获取连接超过该时间才统计为一次等待，排除刚好有连接归还的情况
+const waitThreshold = time.Millisecond
+
+// PoolStats 连接池统计，计数从连接池创建开始累计
+type PoolStats struct {
+	// ActiveCount 连接总数，包括空闲和使用中的连接
+	ActiveCount int `json:"active_count"`
+	IdleCount   int `json:"idle_count"`
+	// InUseCount 借出还未归还的连接数，不包括还在等待空闲连接的调用
+	InUseCount int `json:"in_use_count"`
+
+	// WaitCount、WaitDuration 连接数达到上限时等待空闲连接的次数和累计时间，仅 WithWait(true) 时统计
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration"`
+	// ExhaustedCount 连接数达到上限直接返回 redis.ErrPoolExhausted 的次数
+	ExhaustedCount int64 `json:"exhausted_count"`
+
+	Dials      int64 `json:"dials"`
+	DialErrors int64 `json:"dial_errors"`
+	// Timeouts 建立连接、获取连接或执行命令超时，以及被 ctx 取消的次数
+	Timeouts int64 `json:"timeouts"`
+}
+
+// ConnTracker 记录连接池借出的连接和建立的底层连接，用于统计和优雅关闭：
+// 关闭后拒绝借出新连接，等待借出的连接归还，超时后强制关闭底层连接以中断 BRPOP 等阻塞命令；
+// 订阅等长期占用的专用连接不计入借出，关闭时直接关闭
+type ConnTracker struct {
+	mu        sync.Mutex
+	closed    bool
+	inUse     int
+	done      chan struct{} // 关闭后借出的连接全部归还时关闭
+	conns     map[*trackedConn]struct{}
+	dedicated map[*borrowedConn]struct{}
+
+	waitCount      atomic.Int64
+	waitDuration   atomic.Int64
+	exhaustedCount atomic.Int64
+	dials          atomic.Int64
+	dialErrors     atomic.Int64
+	timeouts       atomic.Int64
+}
+
+// NewConnTracker 创建连接跟踪器
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{
+		done:      make(chan struct{}),
+		conns:     make(map[*trackedConn]struct{}),
+		dedicated: make(map[*borrowedConn]struct{}),
+	}
+}
+
+// Dial 调用 dial 建立连接并统计建立次数和失败次数，在连接池的 Dial 中调用
+func (t *ConnTracker) Dial(dial func() (redis.Conn, error)) (redis.Conn, error) {
+	t.dials.Add(1)
+	c, err := dial()
+	if err != nil {
+		t.dialErrors.Add(1)
+		t.observe(err)
+	}
+	return c, err
+}
+
+// Track 记录新建立的底层连接，在连接池的 Dial 中调用
+func (t *ConnTracker) Track(c redis.Conn) redis.Conn {
+	tc := &trackedConn{Conn: c, tracker: t}
+	t.mu.Lock()
+	t.conns[tc] = struct{}{}
+	t.mu.Unlock()
+	return tc
+}
+
+// Get 从 pool 借出连接，关闭后返回 ErrPoolClosed，借出的连接 Close 时归还计数
+func (t *ConnTracker) Get(ctx context.Context, pool *redis.Pool) (redis.Conn, error) {
+	if t.Closed() {
+		return nil, ErrPoolClosed
+	}
+
+	// 连接数已达上限且没有空闲连接时 GetContext 才会阻塞，只统计这种情况下的等待，不包括建立连接和认证的时间
+	saturated := false
+	if pool.Wait && pool.MaxActive > 0 {
+		stats := pool.Stats()
+		saturated = stats.IdleCount == 0 && stats.ActiveCount >= pool.MaxActive
+	}
+	start := time.Now()
+	c, err := pool.GetContext(ctx)
+	if elapsed := time.Since(start); saturated && elapsed > waitThreshold {
+		t.waitCount.Add(1)
+		t.waitDuration.Add(int64(elapsed))
+	}
+	if err != nil {
+		if err == redis.ErrPoolExhausted {
+			t.exhaustedCount.Add(1)
+		}
+		t.observe(err)
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		c.Close()
+		return nil, ErrPoolClosed
+	}
+	t.inUse++
+	t.mu.Unlock()
+	b := &borrowedConn{Conn: c, tracker: t}
+	// 经连接池转发到底层的 trackedConn，记录对应关系，不会发送到服务端
+	c.Do(bindCommand, b)
+	return b, nil
+}
+
+// Stats 返回 pool 的统计
+func (t *ConnTracker) Stats(pool *redis.Pool) PoolStats {
+	stats := PoolStats{
+		WaitCount:      t.waitCount.Load(),
+		WaitDuration:   time.Duration(t.waitDuration.Load()),
+		ExhaustedCount: t.exhaustedCount.Load(),
+		Dials:          t.dials.Load(),
+		DialErrors:     t.dialErrors.Load(),
+		Timeouts:       t.timeouts.Load(),
+	}
+	if pool != nil {
+		ps := pool.Stats()
+		stats.ActiveCount, stats.IdleCount = ps.ActiveCount, ps.IdleCount
+	}
+	t.mu.Lock()
+	stats.InUseCount = t.inUse
+	t.mu.Unlock()
+	return stats
+}
+
+// observe 统计超时和 ctx 取消错误
+func (t *ConnTracker) observe(err error) {
+	if err == nil {
+		return
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.timeouts.Add(1)
+	}
+}
+
+// Closed 返回是否已经开始关闭
+func (t *ConnTracker) Closed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// Shutdown 拒绝新的借出，立即关闭订阅等专用连接，等待其他借出的连接全部归还后关闭 pool
+// ctx 结束时强制关闭仍在使用的底层连接并返回 ctx.Err()
+func (t *ConnTracker) Shutdown(ctx context.Context, pool *redis.Pool) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		if t.inUse == 0 {
+			close(t.done)
+		}
+	}
+	dedicated := make([]*borrowedConn, 0, len(t.dedicated))
+	for c := range t.dedicated {
+		dedicated = append(dedicated, c)
+	}
+	t.mu.Unlock()
+	// 专用连接阻塞在 Receive 上不会主动归还，关闭底层连接让订阅者退出
+	for _, c := range dedicated {
+		c.abort()
+	}
+
+	select {
+	case <-t.done:
+		return pool.Close()
+	case <-ctx.Done():
+		pool.Close()
+		t.closeAll()
+		return ctx.Err()
+	}
+}
+
+// Close 拒绝新的借出，立即关闭 pool 和所有底层连接，正在执行的命令会返回错误
+func (t *ConnTracker) Close(pool *redis.Pool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := t.Shutdown(ctx, pool); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func (t *ConnTracker) release() {
+	t.mu.Lock()
+	t.inUse--
+	if t.closed && t.inUse == 0 {
+		close(t.done)
+	}
+	t.mu.Unlock()
+}
+
+// dedicate 把借出的连接转为专用连接，不再计入借出，已经开始关闭时直接关闭底层连接
+func (t *ConnTracker) dedicate(c *borrowedConn) {
+	t.mu.Lock()
+	closed := t.closed
+	if !closed {
+		t.dedicated[c] = struct{}{}
+	}
+	t.mu.Unlock()
+	if closed {
+		c.abort()
+		return
+	}
+	c.once.Do(t.release)
+}
+
+func (t *ConnTracker) untrack(c *trackedConn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+}
+
+func (t *ConnTracker) closeAll() {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// bindCommand trackedConn 拦截的内部命令，参数为 *borrowedConn
+const bindCommand = "\x00zredis-bind"
+
+// trackedConn 连接池中的底层连接，关闭时从跟踪器中移除
+type trackedConn struct {
+	redis.Conn
+	tracker *ConnTracker
+}
+
+func (c *trackedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName == bindCommand {
+		if b, ok := args[0].(*borrowedConn); ok {
+			b.raw = c
+		}
+		return nil, nil
+	}
+	return c.Conn.Do(commandName, args...)
+}
+
+func (c *trackedConn) Close() error {
+	c.tracker.untrack(c)
+	return c.Conn.Close()
+}
+
+func (c *trackedConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+}
+
+func (c *trackedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// borrowedConn 借出的连接，Close 归还连接池并减少借出计数
+type borrowedConn struct {
+	redis.Conn
+	tracker *ConnTracker
+	raw     *trackedConn
+	once    sync.Once
+}
+
+// abort 关闭底层连接，中断其他 goroutine 中正在等待回复的命令，连接归还时会被连接池丢弃
+func (c *borrowedConn) abort() bool {
+	if c.raw == nil {
+		return false
+	}
+	c.raw.Close()
+	return true
+}
+
+func (c *borrowedConn) observe(err error) {
+	c.tracker.observe(err)
+}
+
+func (c *borrowedConn) dedicate() {
+	c.tracker.dedicate(c)
+}
+
+func (c *borrowedConn) Close() error {
+	err := c.Conn.Close()
+	c.tracker.mu.Lock()
+	delete(c.tracker.dedicated, c)
+	c.tracker.mu.Unlock()
+	c.once.Do(c.tracker.release)
+	return err
+}
+
+func (c *borrowedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.tracker.observe(err)
+	return reply, err
+}
+
+func (c *borrowedConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.tracker.observe(err)
+	return reply, err
+}
+
+func (c *borrowedConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.tracker.observe(err)
+	return reply, err
+}
+
+func (c *borrowedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := redis.ReceiveWithTimeout(c.Conn, timeout)
+	c.tracker.observe(err)
+	return reply, err
+}
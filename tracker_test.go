@@ -0,0 +1,148 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func newTrackedTestPool(t *testing.T, opts ...Redis_func) *RedisPool {
+	r := newRedisPool(opts...)
+	pool := r.config.NewPool(func() (redis.Conn, error) {
+		return r.config.Dial("127.0.0.1:6379", "27252725", 0)
+	})
+	if err := r.start(pool); err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+	t.Cleanup(func() { r.config.Tracker.Close(pool) })
+	return r
+}
+
+// startBRPop 在后台执行 BRPOP，返回结果通道
+func startBRPop(t *testing.T, r *RedisPool, key string, timeout int) <-chan error {
+	c, err := r.config.Tracker.Get(context.Background(), r.redis_pool)
+	if err != nil {
+		t.Fatalf("Get err: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer c.Close()
+		_, err := redis.Strings(c.Do("BRPOP", key, timeout))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	return done
+}
+
+func TestConnTracker_ShutdownWaits(t *testing.T) {
+	r := newTrackedTestPool(t)
+	commander, _ := newRedisTestCommander(t)
+	commander.Del("test:shutdown:list")
+
+	brpop := startBRPop(t, r, "test:shutdown:list", 5)
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- r.config.Tracker.Shutdown(ctx, r.redis_pool)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := r.config.Tracker.Get(context.Background(), r.redis_pool); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed during shutdown, got %v", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before BRPOP finished: %v", err)
+	default:
+	}
+
+	commander.LPush("test:shutdown:list", "job")
+	if err := <-brpop; err != nil {
+		t.Errorf("Expected BRPOP to finish normally, got %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown err: %v", err)
+	}
+	if stats := r.redis_pool.Stats(); stats.ActiveCount != 0 {
+		t.Errorf("Expected all connections closed, got %+v", stats)
+	}
+}
+
+func TestConnTracker_ShutdownTimeout(t *testing.T) {
+	r := newTrackedTestPool(t)
+	brpop := startBRPop(t, r, "test:shutdown:forever", 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := r.config.Tracker.Shutdown(ctx, r.redis_pool); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	select {
+	case err := <-brpop:
+		if err == nil {
+			t.Error("Expected BRPOP interrupted with error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BRPOP not interrupted after shutdown timeout")
+	}
+}
+
+func TestConnTracker_Close(t *testing.T) {
+	r := newTrackedTestPool(t)
+	brpop := startBRPop(t, r, "test:shutdown:forever", 0)
+
+	if err := r.config.Tracker.Close(r.redis_pool); err != nil {
+		t.Errorf("Close err: %v", err)
+	}
+	select {
+	case err := <-brpop:
+		if err == nil {
+			t.Error("Expected BRPOP interrupted with error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BRPOP not interrupted after Close")
+	}
+	if _, err := r.config.Tracker.Get(context.Background(), r.redis_pool); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed after Close, got %v", err)
+	}
+}
+
+func TestConnTracker_ShutdownSubscriber(t *testing.T) {
+	r := newTrackedTestPool(t)
+	s := NewSubscriberWithConn(func(ctx context.Context) (redis.Conn, error) {
+		return r.config.Tracker.Get(ctx, r.redis_pool)
+	}, WithSubscriberRetryBackoff(10*time.Millisecond))
+	defer s.Close()
+	if err := s.Subscribe("test:shutdown:channel"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if stats := r.config.Tracker.Stats(r.redis_pool); stats.InUseCount != 0 {
+		t.Errorf("Expected subscription connection not counted as in use, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := r.config.Tracker.Shutdown(ctx, r.redis_pool); err != nil {
+		t.Errorf("Shutdown err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown waited for the subscription connection: %v", elapsed)
+	}
+	select {
+	case _, ok := <-s.Messages():
+		if ok {
+			t.Error("Expected no messages after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Messages not closed after shutdown")
+	}
+	if err := s.Subscribe("test:shutdown:other"); !errors.Is(err, ErrSubscriberClosed) {
+		t.Errorf("Expected ErrSubscriberClosed, got %v", err)
+	}
+}
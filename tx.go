@@ -0,0 +1,191 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrTxFailed WATCH 的键在事务执行前被修改，重试次数用尽后返回
+var ErrTxFailed = errors.New("zredis: transaction failed, watched keys changed")
+
+// TxFunc 事务回调，通过 tx 排队需要在 MULTI/EXEC 之间执行的命令
+type TxFunc func(tx *Tx) error
+
+type txOptions struct {
+	watchKeys  []string
+	maxRetries int
+}
+
+type Tx_func func(*txOptions)
+
+// WithTxWatch 设置需要 WATCH 的键
+func WithTxWatch(keys ...string) Tx_func {
+	return func(o *txOptions) {
+		o.watchKeys = append(o.watchKeys, keys...)
+	}
+}
+
+// WithTxMaxRetries 设置 WATCH 的键被修改时的最大重试次数，默认3次
+func WithTxMaxRetries(maxRetries int) Tx_func {
+	return func(o *txOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// Tx 事务，固定一个连接执行 WATCH/MULTI/EXEC
+// 通过嵌入的 RedisCommander 调用的命令只会入队并返回 ErrQueued，EXEC 后统一返回结果；
+// 需要在 WATCH 之后读取当前值时使用 Conn() 立即执行
+type Tx struct {
+	RedisCommander
+	conn redis.Conn
+	cmds []pipelineCmd
+}
+
+func newTx(c redis.Conn) *Tx {
+	tx := &Tx{conn: c}
+	tx.RedisCommander = NewRedisCommands(tx.queue, tx.queueLua, withQueuedCommands())
+	return tx
+}
+
+func (tx *Tx) queue(cmdStr string, keysAndArgs ...interface{}) (interface{}, error) {
+	tx.cmds = append(tx.cmds, pipelineCmd{cmd: cmdStr, args: keysAndArgs})
+	return nil, ErrQueued
+}
+
+func (tx *Tx) queueLua(script string, key string, args ...interface{}) (interface{}, error) {
+	return tx.queue("EVAL", append([]interface{}{script, 1, key}, args...)...)
+}
+
+func (tx *Tx) queuesCommands() bool {
+	return true
+}
+
+// Conn 返回在事务固定连接上立即执行的命令实例，只应在回调内使用
+func (tx *Tx) Conn() RedisCommander {
+	return NewRedisCommands(tx.conn.Do, func(script string, key string, args ...interface{}) (interface{}, error) {
+		return CachedScript(script).Do(tx.conn, []string{key}, args...)
+	})
+}
+
+// TxPipelined 基于全局连接池执行事务
+func TxPipelined(ctx context.Context, fn TxFunc, opts ...Tx_func) ([]PipelineResult, error) {
+	return TxPipelinedWithConn(ctx, getConn, fn, opts...)
+}
+
+// TxPipelinedWithConn 使用指定的连接获取函数执行事务
+// 每次尝试都会在新连接上 WATCH 指定的键并调用 fn，EXEC 因键被修改返回 nil 时自动重试
+func TxPipelinedWithConn(ctx context.Context, getConn ConnGetter, fn TxFunc, opts ...Tx_func) ([]PipelineResult, error) {
+	o := &txOptions{maxRetries: 3}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	for attempt := 0; ; attempt++ {
+		c, err := getConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []PipelineResult
+		_, err = RunContext(ctx, c, func(c redis.Conn) (interface{}, error) {
+			var err error
+			results, err = execTx(ctx, c, o.watchKeys, fn)
+			return nil, err
+		})
+		if err == ErrTxFailed && attempt < o.maxRetries {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			return results, err
+		}
+		for _, res := range results {
+			if res.Err != nil {
+				return results, res.Err
+			}
+		}
+		return results, nil
+	}
+}
+
+// execTx 在连接c上执行一次完整的事务
+func execTx(ctx context.Context, c redis.Conn, watchKeys []string, fn TxFunc) ([]PipelineResult, error) {
+	if len(watchKeys) > 0 {
+		args := make([]interface{}, len(watchKeys))
+		for i, key := range watchKeys {
+			args[i] = key
+		}
+		if _, err := c.Do("WATCH", args...); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := newTx(c)
+	// 回调直接返回入队命令的 ErrQueued 时视为成功
+	if err := fn(tx); err != nil && err != ErrQueued {
+		c.Do("UNWATCH")
+		return nil, err
+	}
+	if len(tx.cmds) == 0 {
+		if len(watchKeys) > 0 {
+			c.Do("UNWATCH")
+		}
+		return nil, nil
+	}
+
+	results := make([]PipelineResult, len(tx.cmds))
+	c.Send("MULTI")
+	for i, cmd := range tx.cmds {
+		results[i] = PipelineResult{Cmd: cmd.cmd, Args: cmd.args}
+		c.Send(cmd.cmd, cmd.args...)
+	}
+	c.Send("EXEC")
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	// MULTI 和每条命令的 QUEUED 回复
+	for i := 0; i <= len(tx.cmds); i++ {
+		if _, err := receiveContext(ctx, c); err != nil {
+			if _, ok := err.(redis.Error); !ok {
+				return nil, err
+			}
+			if i > 0 {
+				results[i-1].Err = err
+			}
+		}
+	}
+
+	reply, err := receiveContext(ctx, c)
+	if err != nil {
+		// EXECABORT 时返回入队阶段的错误
+		if _, ok := err.(redis.Error); ok {
+			for _, res := range results {
+				if res.Err != nil {
+					return results, res.Err
+				}
+			}
+		}
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrTxFailed
+	}
+	replies, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if i >= len(replies) {
+			break
+		}
+		results[i].Reply = replies[i]
+		if e, ok := replies[i].(redis.Error); ok {
+			results[i].Reply, results[i].Err = nil, e
+		}
+	}
+	return results, nil
+}
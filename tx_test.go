@@ -0,0 +1,90 @@
+package zredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 模拟事务回复，前 failures 次 EXEC 返回 nil 表示 WATCH 的键被修改
+func newTxConn(failures int) (*pipeConn, *int) {
+	execs := 0
+	conn := &pipeConn{}
+	conn.reply = func(cmd string, args []interface{}) (interface{}, error) {
+		switch cmd {
+		case "GET":
+			return []byte("10"), nil
+		case "MULTI", "WATCH", "UNWATCH":
+			return "OK", nil
+		case "EXEC":
+			execs++
+			if execs <= failures {
+				return nil, nil
+			}
+			return []interface{}{int64(11), int64(1)}, nil
+		}
+		return "QUEUED", nil
+	}
+	return conn, &execs
+}
+
+func TestTxPipelined(t *testing.T) {
+	conn, execs := newTxConn(1)
+	results, err := TxPipelinedWithConn(context.Background(), newPipeConnGetter(conn), func(tx *Tx) error {
+		n, err := redis.Int(tx.Conn().Get("test:zset:counter"))
+		if err != nil {
+			return err
+		}
+		tx.ZIncrBy("test:zset", n+1, "member")
+		return tx.Expire("test:zset", 3600)
+	}, WithTxWatch("test:zset:counter"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *execs != 2 {
+		t.Errorf("Expected transaction to be retried once, got %d EXEC", *execs)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Cmd != "ZINCRBY" || results[0].Reply != int64(11) {
+		t.Errorf("Expected ZINCRBY result 11, got %v %v", results[0].Cmd, results[0].Reply)
+	}
+	if conn.sent[0] != "WATCH" {
+		t.Errorf("Expected WATCH to be sent first, got %v", conn.sent)
+	}
+}
+
+func TestTxPipelined_RetriesExhausted(t *testing.T) {
+	conn, execs := newTxConn(10)
+	_, err := TxPipelinedWithConn(context.Background(), newPipeConnGetter(conn), func(tx *Tx) error {
+		tx.Set("test:key1", "value1")
+		return nil
+	}, WithTxWatch("test:key1"), WithTxMaxRetries(2))
+	if !errors.Is(err, ErrTxFailed) {
+		t.Errorf("Expected ErrTxFailed, got %v", err)
+	}
+	if *execs != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *execs)
+	}
+}
+
+func TestTxPipelined_CallbackError(t *testing.T) {
+	conn, execs := newTxConn(0)
+	fnErr := errors.New("balance not enough")
+	_, err := TxPipelinedWithConn(context.Background(), newPipeConnGetter(conn), func(tx *Tx) error {
+		tx.Set("test:key1", "value1")
+		return fnErr
+	}, WithTxWatch("test:key1"))
+	if !errors.Is(err, fnErr) {
+		t.Errorf("Expected callback error, got %v", err)
+	}
+	if *execs != 0 {
+		t.Errorf("Expected no EXEC, got %d", *execs)
+	}
+	if conn.sent[len(conn.sent)-1] != "UNWATCH" {
+		t.Errorf("Expected UNWATCH after callback error, got %v", conn.sent)
+	}
+}
@@ -0,0 +1,135 @@
+package zredis
+
+import (
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrNil key 或字段不存在时返回，与 redis.ErrNil 相同，可以使用 errors.Is 判断
+var ErrNil = redis.ErrNil
+
+// Scalar 可以直接从回复转换的基础类型
+type Scalar interface {
+	string | []byte | int | int64 | uint64 | float64 | bool
+}
+
+// Z 有序集合成员及分数
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// As 把命令的回复转换为类型 T，回复为 nil 时返回 ErrNil
+func As[T Scalar](reply interface{}, err error) (T, error) {
+	var zero T
+	var v interface{}
+	switch any(zero).(type) {
+	case string:
+		v, err = redis.String(reply, err)
+	case []byte:
+		v, err = redis.Bytes(reply, err)
+	case int:
+		v, err = redis.Int(reply, err)
+	case int64:
+		v, err = redis.Int64(reply, err)
+	case uint64:
+		v, err = redis.Uint64(reply, err)
+	case float64:
+		v, err = redis.Float64(reply, err)
+	case bool:
+		v, err = redis.Bool(reply, err)
+	}
+	if err != nil {
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// Get 获取 key 的值并转换为类型 T
+func Get[T Scalar](commander RedisCommander, key string) (T, error) {
+	return As[T](commander.Get(key))
+}
+
+// HGet 获取哈希字段的值并转换为类型 T
+func HGet[T Scalar](commander RedisCommander, key string, field string) (T, error) {
+	return As[T](commander.Hget(key, field))
+}
+
+// HGetAll 获取哈希的所有字段
+func HGetAll(commander RedisCommander, key string) (map[string]string, error) {
+	return redis.StringMap(commander.HgetAll(key))
+}
+
+// HMGet 获取多个哈希字段，不存在的字段为空字符串
+func HMGet(commander RedisCommander, key string, fields ...string) ([]string, error) {
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		args[i] = field
+	}
+	return redis.Strings(commander.HMget(key, args))
+}
+
+// HExists 判断哈希字段是否存在，与 RedisCommander.Hexists 不同，会返回命令的错误
+func HExists(commander RedisCommander, key string, field string) (bool, error) {
+	return redis.Bool(commander.Cmd("HEXISTS", key, field))
+}
+
+// Exists 判断 key 是否存在
+func Exists(commander RedisCommander, key string) (bool, error) {
+	return redis.Bool(commander.Exists(key))
+}
+
+// Keys 获取匹配的 key 列表
+func Keys(commander RedisCommander, pattern string) ([]string, error) {
+	return redis.Strings(commander.Keys(pattern))
+}
+
+// SMembers 获取集合的所有成员
+func SMembers(commander RedisCommander, key string) ([]string, error) {
+	return redis.Strings(commander.SMembers(key))
+}
+
+// ZScore 获取有序集合成员的分数，成员不存在时返回 ErrNil
+func ZScore(commander RedisCommander, key string, member interface{}) (float64, error) {
+	return redis.Float64(commander.ZScore(key, member))
+}
+
+// ZRangeWithScores 按分数从小到大获取有序集合成员及分数
+func ZRangeWithScores(commander RedisCommander, key string, start, end int) ([]Z, error) {
+	return toZ(commander.ZRange(key, start, end, true))
+}
+
+// ZRevRangeWithScores 按分数从大到小获取有序集合成员及分数
+func ZRevRangeWithScores(commander RedisCommander, key string, start, end int) ([]Z, error) {
+	return toZ(commander.ZRevRange(key, start, end, true))
+}
+
+// ZRangeByScoreWithScores 获取分数区间内的有序集合成员及分数
+func ZRangeByScoreWithScores(commander RedisCommander, key string, min, max interface{}) ([]Z, error) {
+	return toZ(commander.ZRangeByScore(key, min, max, true))
+}
+
+// toZ 把 WITHSCORES 的回复转换为 []Z
+func toZ(reply interface{}, err error) ([]Z, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("zredis: WITHSCORES reply has odd number of elements")
+	}
+	res := make([]Z, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		member, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		score, err := redis.Float64(values[i+1], nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Z{Member: member, Score: score})
+	}
+	return res, nil
+}
@@ -0,0 +1,95 @@
+package zredis
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTypedCommander(results map[string]interface{}) RedisCommander {
+	mock := &mockExecutor{
+		commands: []string{},
+		results:  results,
+	}
+	return NewRedisCommands(mock.execute, mock.luaExecute)
+}
+
+func TestTyped_Get(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{"GET": []byte("42")})
+	s, err := Get[string](commander, "test:key1")
+	if err != nil || s != "42" {
+		t.Errorf("Expected '42', got %v %v", s, err)
+	}
+	n, err := Get[int64](commander, "test:key1")
+	if err != nil || n != 42 {
+		t.Errorf("Expected 42, got %v %v", n, err)
+	}
+	f, err := Get[float64](commander, "test:key1")
+	if err != nil || f != 42 {
+		t.Errorf("Expected 42, got %v %v", f, err)
+	}
+}
+
+func TestTyped_GetNil(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{"GET": nil})
+	_, err := Get[string](commander, "test:missing")
+	if !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+}
+
+func TestTyped_HGetAll(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{
+		"HGETALL": []interface{}{[]byte("name"), []byte("John"), []byte("age"), []byte("30")},
+	})
+	m, err := HGetAll(commander, "test:hash:user")
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if m["name"] != "John" || m["age"] != "30" {
+		t.Errorf("Expected map with name and age, got %v", m)
+	}
+}
+
+func TestTyped_HExists(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{})
+	ok, err := HExists(commander, "test:hash:user", "name")
+	if err != nil || !ok {
+		t.Errorf("Expected true, got %v %v", ok, err)
+	}
+	failing := NewRedisCommands(func(string, ...interface{}) (interface{}, error) {
+		return nil, errors.New("connection refused")
+	}, nil)
+	if _, err := HExists(failing, "test:hash:user", "name"); err == nil {
+		t.Errorf("Expected error to be returned")
+	}
+}
+
+func TestTyped_SMembers(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{
+		"SMEMBERS": []interface{}{[]byte("golang"), []byte("redis")},
+	})
+	members, err := SMembers(commander, "test:set:tags")
+	if err != nil || len(members) != 2 || members[0] != "golang" {
+		t.Errorf("Expected [golang redis], got %v %v", members, err)
+	}
+}
+
+func TestTyped_ZRangeWithScores(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{
+		"ZRANGE": []interface{}{[]byte("player1"), []byte("85"), []byte("player2"), []byte("100.5")},
+	})
+	zs, err := ZRangeWithScores(commander, "test:zset", 0, -1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(zs) != 2 || zs[0] != (Z{Member: "player1", Score: 85}) || zs[1] != (Z{Member: "player2", Score: 100.5}) {
+		t.Errorf("Unexpected result %v", zs)
+	}
+}
+
+func TestTyped_ZScoreNil(t *testing.T) {
+	commander := newTypedCommander(map[string]interface{}{"ZSCORE": nil})
+	if _, err := ZScore(commander, "test:zset", "missing"); !errors.Is(err, ErrNil) {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+}